@@ -0,0 +1,437 @@
+package binomv2postback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+// Пути Binom v2 API по умолчанию, см. APIWithPaths
+const (
+	DefaultAPIClickPath       = "/public/api/v1/click/"
+	DefaultAPIConversionsPath = "/public/api/v1/conversions"
+)
+
+// apiTimeLayout формат времени в запросах и ответах API
+const apiTimeLayout = "2006-01-02 15:04:05"
+
+// apiPageSize сколько конверсий запрашивается за раз
+const apiPageSize = 500
+
+// DefaultAPIMaxPages сколько страниц конверсий Conversions запрашивает по умолчанию, см. APIWithMaxPages
+const DefaultAPIMaxPages = 200
+
+// ErrTooManyConversions конверсии за период не уместились в APIWithMaxPages страниц
+var ErrTooManyConversions = errors.New("too many conversions")
+
+// APIError Binom API ответил ошибкой. Для 404 при поиске клика Err = ErrClickNotFound.
+type APIError struct {
+	StatusCode int
+	URL        string
+	Message    string
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("binom api %s: status code %d: %s", e.URL, e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// ClickInfo состояние клика в трекере.
+type ClickInfo struct {
+	ClickID           string
+	CampaignID        int64
+	CampaignName      string
+	Events            Events // текущие значения событий (eventX=значение)
+	IsConversion      bool
+	ConversionStatus  string
+	ConversionStatus2 string
+	Payout            Money // выплата в валюте Currency без потерь точности
+	Currency          string
+	ClickTime         time.Time
+}
+
+// Event возвращает текущее значение события index.
+func (c *ClickInfo) Event(index int8) (int64, bool) {
+	ev, ok := c.Events.Get(index)
+	if !ok {
+		return 0, false
+	}
+
+	return ev.Value(), true
+}
+
+// Conversion конверсия из списка конверсий трекера.
+type Conversion struct {
+	ClickID           string
+	CampaignID        int64
+	ConversionStatus  string
+	ConversionStatus2 string
+	Payout            Money // выплата в валюте Currency без потерь точности
+	Currency          string
+	Time              time.Time
+}
+
+// APIOption настройка APIClient
+type APIOption func(api *APIClient) error
+
+// APIClient клиент Binom v2 API для чтения состояния кликов и конверсий.
+// Ключ передается в заголовке api-key.
+type APIClient struct {
+	baseURL         *url.URL
+	apiKey          string
+	httpClient      *http.Client
+	log             Logger
+	clickPath       string
+	conversionsPath string
+	maxPages        int
+}
+
+// NewAPIClient создает клиент API трекера по адресу baseURL (https://binom.tracker).
+func NewAPIClient(baseURL string, apiKey string, opts ...APIOption) (*APIClient, error) {
+	if err := validateClickBaseURL(baseURL); err != nil {
+		return nil, fmt.Errorf("api: %w", err)
+	}
+	u, _ := url.Parse(baseURL)
+	api := &APIClient{
+		baseURL:         u,
+		apiKey:          apiKey,
+		httpClient:      &http.Client{},
+		clickPath:       DefaultAPIClickPath,
+		conversionsPath: DefaultAPIConversionsPath,
+		maxPages:        DefaultAPIMaxPages,
+	}
+	for _, f := range opts {
+		if err := f(api); err != nil {
+			return nil, err
+		}
+	}
+
+	return api, nil
+}
+
+// NewAPIClientFromConfig создает клиент API по настройкам cfg.
+// Без api_url адрес API берется из click_url (схема и хост).
+func NewAPIClientFromConfig(cfg Config, opts ...APIOption) (*APIClient, error) {
+	apiKey, err := readSecret(cfg.APIKey, cfg.APIKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read api key: %w", err)
+	}
+	baseURL := cfg.APIURL
+	if baseURL == "" {
+		u, err := url.Parse(cfg.ClickURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid click base URL: %w", err)
+		}
+		baseURL = u.Scheme + "://" + u.Host
+	}
+	if cfg.Timeout > 0 {
+		opts = append([]APIOption{APIWithHTTPClient(&http.Client{Timeout: time.Duration(cfg.Timeout)})}, opts...)
+	}
+
+	return NewAPIClient(baseURL, apiKey, opts...)
+}
+
+// APIWithHTTPClient задает http.Client для запросов к API.
+func APIWithHTTPClient(httpClient *http.Client) APIOption {
+	return func(api *APIClient) error {
+		if httpClient == nil {
+			return errors.New("nil http client")
+		}
+		api.httpClient = httpClient
+		return nil
+	}
+}
+
+// APIWithLogger задает логгер запросов к API.
+func APIWithLogger(log Logger) APIOption {
+	return func(api *APIClient) error {
+		api.log = log
+		return nil
+	}
+}
+
+// APIWithPaths задает пути API клика (к нему добавляется clickID) и списка конверсий.
+func APIWithPaths(clickPath, conversionsPath string) APIOption {
+	return func(api *APIClient) error {
+		if clickPath == "" || conversionsPath == "" {
+			return errors.New("empty api path")
+		}
+		api.clickPath = clickPath
+		api.conversionsPath = conversionsPath
+		return nil
+	}
+}
+
+// APIWithMaxPages ограничивает число страниц (по 500 конверсий), которые запрашивает Conversions.
+func APIWithMaxPages(n int) APIOption {
+	return func(api *APIClient) error {
+		if n < 1 {
+			return errors.New("api max pages must be positive")
+		}
+		api.maxPages = n
+		return nil
+	}
+}
+
+// Click возвращает состояние клика clickID. Для неизвестного клика
+// возвращает ошибку, для которой errors.Is(err, ErrClickNotFound).
+func (api *APIClient) Click(ctx context.Context, clickID string) (*ClickInfo, error) {
+	if clickID == "" {
+		return nil, ErrMissingClickID
+	}
+	path := strings.TrimSuffix(api.clickPath, "/") + "/" + url.PathEscape(clickID)
+
+	var body apiClick
+	if err := api.get(ctx, path, nil, &body); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			apiErr.Err = ErrClickNotFound
+		}
+		return nil, err
+	}
+	info, err := body.clickInfo()
+	if err != nil {
+		return nil, err
+	}
+	if info.ClickID == "" {
+		info.ClickID = clickID
+	}
+
+	return info, nil
+}
+
+// Conversions возвращает конверсии с from по to (время UTC), запрашивая их страницами.
+// Запрос прекращается на неполной странице или странице без новых конверсий
+// (API не учел offset), больше APIWithMaxPages страниц - ErrTooManyConversions.
+func (api *APIClient) Conversions(ctx context.Context, from, to time.Time) ([]Conversion, error) {
+	var out []Conversion
+	seen := make(map[Conversion]bool)
+	for page := 0; ; page++ {
+		if page >= api.maxPages {
+			return nil, fmt.Errorf("%w: more than %d pages from %s to %s", ErrTooManyConversions, api.maxPages, from, to)
+		}
+		offset := page * apiPageSize
+		q := url.Values{}
+		q.Set("date_from", from.UTC().Format(apiTimeLayout))
+		q.Set("date_to", to.UTC().Format(apiTimeLayout))
+		q.Set("timezone", "UTC")
+		q.Set("limit", strconv.Itoa(apiPageSize))
+		q.Set("offset", strconv.Itoa(offset))
+
+		var list []apiConversion
+		if err := api.get(ctx, api.conversionsPath, q, &list); err != nil {
+			return nil, err
+		}
+		added := 0
+		for _, c := range list {
+			conv, err := c.conversion()
+			if err != nil {
+				return nil, err
+			}
+			if seen[conv] {
+				continue
+			}
+			seen[conv] = true
+			out = append(out, conv)
+			added++
+		}
+		if len(list) < apiPageSize {
+			return out, nil
+		}
+		if added == 0 {
+			if api.log != nil {
+				api.log.Errorf("Binom API %s: page at offset %d repeats previous conversions, stop paging", api.conversionsPath, offset)
+			}
+			return out, nil
+		}
+	}
+}
+
+// get выполняет GET запрос к API по экранированному пути path и разбирает JSON-ответ в out.
+func (api *APIClient) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	u := *api.baseURL
+	rawPath := strings.TrimSuffix(u.EscapedPath(), "/") + path
+	unescaped, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return fmt.Errorf("binom api: invalid path %q: %w", rawPath, err)
+	}
+	u.Path, u.RawPath = unescaped, rawPath
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("api-key", api.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if api.log != nil {
+		api.log.Debugf("Binom API request: GET %s", u.String())
+	}
+
+	resp, err := api.httpClient.Do(req)
+	if err != nil {
+		return &TransportError{URL: u.String(), Err: err}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseBodySize*16))
+	if err != nil {
+		return &TransportError{URL: u.String(), Err: fmt.Errorf("failed to read response body: %w", err)}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &APIError{StatusCode: resp.StatusCode, URL: u.String(), Message: responseMessage(body)}
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("binom api %s: invalid response: %w", u.String(), err)
+	}
+
+	return nil
+}
+
+// apiClick объект клика в ответе API v2, события - {"event1": 2, "event5": 1}.
+type apiClick struct {
+	ClickID      string           `json:"click_id"`
+	CampaignID   apiNumber        `json:"campaign_id"`
+	CampaignName string           `json:"campaign_name"`
+	Events       map[string]int64 `json:"events"`
+	IsConversion bool             `json:"is_conversion"`
+	Status       string           `json:"cnv_status"`
+	Status2      string           `json:"cnv_status2"`
+	Payout       apiNumber        `json:"payout"`
+	Currency     string           `json:"currency"`
+	ClickTime    apiTime          `json:"click_time"`
+}
+
+func (c apiClick) clickInfo() (*ClickInfo, error) {
+	events := Events{}
+	for name, value := range c.Events {
+		digits, ok := strings.CutPrefix(name, "event")
+		index, err := strconv.ParseInt(digits, 10, 8)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("binom api: invalid event %q", name)
+		}
+		if err := events.Set(binom.Event(int8(index), value), true); err != nil {
+			return nil, fmt.Errorf("binom api: %w", err)
+		}
+	}
+
+	payout, err := c.Payout.money(Currency(c.Currency))
+	if err != nil {
+		return nil, fmt.Errorf("binom api: payout: %w", err)
+	}
+
+	return &ClickInfo{
+		ClickID:           c.ClickID,
+		CampaignID:        c.CampaignID.int64(),
+		CampaignName:      c.CampaignName,
+		Events:            events,
+		IsConversion:      c.IsConversion || c.Status != "" || !payout.IsZero(),
+		ConversionStatus:  c.Status,
+		ConversionStatus2: c.Status2,
+		Payout:            payout,
+		Currency:          c.Currency,
+		ClickTime:         time.Time(c.ClickTime),
+	}, nil
+}
+
+// apiConversion элемент массива конверсий в ответе API v2
+type apiConversion struct {
+	ClickID    string    `json:"click_id"`
+	CampaignID apiNumber `json:"campaign_id"`
+	Status     string    `json:"cnv_status"`
+	Status2    string    `json:"cnv_status2"`
+	Payout     apiNumber `json:"payout"`
+	Currency   string    `json:"currency"`
+	Time       apiTime   `json:"time"`
+}
+
+func (c apiConversion) conversion() (Conversion, error) {
+	if c.ClickID == "" {
+		return Conversion{}, errors.New("binom api: conversion without click_id")
+	}
+	payout, err := c.Payout.money(Currency(c.Currency))
+	if err != nil {
+		return Conversion{}, fmt.Errorf("binom api: conversion %s payout: %w", c.ClickID, err)
+	}
+
+	return Conversion{
+		ClickID:           c.ClickID,
+		CampaignID:        c.CampaignID.int64(),
+		ConversionStatus:  c.Status,
+		ConversionStatus2: c.Status2,
+		Payout:            payout,
+		Currency:          c.Currency,
+		Time:              time.Time(c.Time),
+	}, nil
+}
+
+// apiNumber число, которое API может вернуть как числом, так и строкой.
+// Хранит десятичную запись, чтобы выплата разбиралась в Money без потерь.
+type apiNumber string
+
+func (n *apiNumber) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*n = ""
+		return nil
+	}
+	if _, err := strconv.ParseFloat(s, 64); err != nil {
+		return fmt.Errorf("invalid number %s", data)
+	}
+	*n = apiNumber(s)
+
+	return nil
+}
+
+// int64 возвращает целую часть числа, 0 для пустого значения.
+func (n apiNumber) int64() int64 {
+	f, _ := strconv.ParseFloat(string(n), 64)
+	return int64(f)
+}
+
+// money разбирает число как сумму в валюте currency, пустое значение - 0.
+func (n apiNumber) money(currency Currency) (Money, error) {
+	if n == "" {
+		return Money{}.WithCurrency(currency), nil
+	}
+
+	return ParseMoney(string(n), currency)
+}
+
+// apiTime время в формате "2006-01-02 15:04:05" (UTC), RFC 3339 или unix-время.
+type apiTime time.Time
+
+func (t *apiTime) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*t = apiTime{}
+		return nil
+	}
+	if ts, err := time.ParseInLocation(apiTimeLayout, s, time.UTC); err == nil {
+		*t = apiTime(ts)
+		return nil
+	}
+	if ts, err := time.Parse(time.RFC3339, s); err == nil {
+		*t = apiTime(ts)
+		return nil
+	}
+	if unix, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*t = apiTime(time.Unix(unix, 0).UTC())
+		return nil
+	}
+
+	return fmt.Errorf("invalid time %s", data)
+}
@@ -0,0 +1,192 @@
+package binomv2postback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestAPIClient(t *testing.T, handler http.HandlerFunc, opts ...APIOption) *APIClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	api, err := NewAPIClient(srv.URL, "secret", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return api
+}
+
+func TestAPIClientClick(t *testing.T) {
+	api := newTestAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("api-key"); got != "secret" {
+			t.Errorf("api-key header = %q", got)
+		}
+		if r.URL.EscapedPath() != DefaultAPIClickPath+"abc%2F1" {
+			t.Errorf("path = %q", r.URL.EscapedPath())
+		}
+		fmt.Fprint(w, `{
+			"campaign_id": "12",
+			"campaign_name": "test",
+			"events": {"event1": 2, "event5": 1},
+			"cnv_status": "approved",
+			"payout": "1.5",
+			"currency": "USD",
+			"click_time": "2024-03-01 10:20:30"
+		}`)
+	})
+
+	info, err := api.Click(context.Background(), "abc/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ClickID != "abc/1" || info.CampaignID != 12 || info.CampaignName != "test" {
+		t.Errorf("click = %+v", info)
+	}
+	if want, _ := ParseMoney("1.5", "USD"); !info.IsConversion || info.ConversionStatus != "approved" || !info.Payout.Equal(want) || info.Currency != "USD" {
+		t.Errorf("conversion = %+v", info)
+	}
+	if want := time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC); !info.ClickTime.Equal(want) {
+		t.Errorf("click time = %s, want %s", info.ClickTime, want)
+	}
+	if v, ok := info.Event(1); !ok || v != 2 {
+		t.Errorf("event1 = %d, %v", v, ok)
+	}
+	if v, ok := info.Event(5); !ok || v != 1 {
+		t.Errorf("event5 = %d, %v", v, ok)
+	}
+	if _, ok := info.Event(2); ok {
+		t.Error("event2 is set")
+	}
+}
+
+func TestAPIClientPayout(t *testing.T) {
+	tests := []struct {
+		payout string
+		want   string
+		cnv    bool
+	}{
+		{`0.30000001`, "0.30000001", true},
+		{`"12.10"`, "12.1", true},
+		{`1e2`, "100", true},
+		{`"0"`, "0", false},
+		{`null`, "0", false},
+	}
+	for _, tt := range tests {
+		api := newTestAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"payout": %s, "currency": "EUR"}`, tt.payout)
+		})
+		info, err := api.Click(context.Background(), "c1")
+		if err != nil {
+			t.Fatalf("payout %s: %v", tt.payout, err)
+		}
+		if info.Payout.String() != tt.want || info.Payout.Currency() != "EUR" || info.IsConversion != tt.cnv {
+			t.Errorf("payout %s = %s %s, conversion %v", tt.payout, info.Payout, info.Payout.Currency(), info.IsConversion)
+		}
+	}
+
+	api := newTestAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"click_id": "c1", "payout": "NaN"}]`)
+	})
+	if _, err := api.Conversions(context.Background(), time.Now().Add(-time.Hour), time.Now()); !errors.Is(err, ErrInvalidMoney) {
+		t.Errorf("invalid payout: %v", err)
+	}
+}
+
+func TestAPIClientClickNotFound(t *testing.T) {
+	api := newTestAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error": "click not found"}`)
+	})
+
+	_, err := api.Click(context.Background(), "missing")
+	if !errors.Is(err, ErrClickNotFound) {
+		t.Fatalf("err = %v, want ErrClickNotFound", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "click not found" {
+		t.Errorf("api error = %+v", apiErr)
+	}
+}
+
+// conversionsPage возвращает n конверсий, начиная с номера offset
+func conversionsPage(offset, n int) []map[string]interface{} {
+	page := make([]map[string]interface{}, 0, n)
+	for i := offset; i < offset+n; i++ {
+		page = append(page, map[string]interface{}{
+			"click_id":   "c" + strconv.Itoa(i),
+			"cnv_status": "approved",
+			"payout":     1,
+			"time":       "2024-03-01 00:00:00",
+		})
+	}
+
+	return page
+}
+
+func TestAPIClientConversionsPaging(t *testing.T) {
+	var offsets []string
+	api := newTestAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		offsets = append(offsets, q.Get("offset"))
+		if q.Get("date_from") != "2024-03-01 00:00:00" || q.Get("date_to") != "2024-03-02 00:00:00" || q.Get("limit") != "500" {
+			t.Errorf("query = %s", r.URL.RawQuery)
+		}
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		n := apiPageSize
+		if offset > 0 {
+			n = 3
+		}
+		json.NewEncoder(w).Encode(conversionsPage(offset, n))
+	})
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	conversions, err := api.Conversions(context.Background(), from, from.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversions) != apiPageSize+3 {
+		t.Errorf("got %d conversions, want %d", len(conversions), apiPageSize+3)
+	}
+	if len(offsets) != 2 || offsets[0] != "0" || offsets[1] != "500" {
+		t.Errorf("offsets = %q", offsets)
+	}
+	if last := conversions[len(conversions)-1]; last.ClickID != "c502" || last.Payout.String() != "1" || !last.Time.Equal(from) {
+		t.Errorf("last conversion = %+v", last)
+	}
+}
+
+func TestAPIClientConversionsIgnoredOffset(t *testing.T) {
+	requests := 0
+	api := newTestAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(conversionsPage(0, apiPageSize))
+	})
+
+	conversions, err := api.Conversions(context.Background(), time.Now().Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversions) != apiPageSize || requests != 2 {
+		t.Errorf("got %d conversions in %d requests", len(conversions), requests)
+	}
+}
+
+func TestAPIClientConversionsMaxPages(t *testing.T) {
+	api := newTestAPIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		json.NewEncoder(w).Encode(conversionsPage(offset, apiPageSize))
+	}, APIWithMaxPages(2))
+
+	_, err := api.Conversions(context.Background(), time.Now().Add(-time.Hour), time.Now())
+	if !errors.Is(err, ErrTooManyConversions) {
+		t.Fatalf("err = %v, want ErrTooManyConversions", err)
+	}
+}
@@ -0,0 +1,456 @@
+package binomv2postback
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+var (
+	// ErrQueueFull очередь AsyncClient заполнена (BackpressureError)
+	ErrQueueFull = errors.New("async queue is full")
+	// ErrRequestDropped запрос вытеснен из заполненной очереди более новым (BackpressureDropOldest)
+	ErrRequestDropped = errors.New("request dropped from async queue")
+	// ErrAsyncClosed AsyncClient закрыт и не принимает запросы
+	ErrAsyncClosed = errors.New("async client closed")
+)
+
+var _ Client = (*AsyncClient)(nil)
+
+// Backpressure поведение AsyncClient при заполненной очереди
+type Backpressure int
+
+const (
+	BackpressureBlock      Backpressure = iota // ждать освобождения места в очереди
+	BackpressureDropOldest                     // вытеснить самый старый запрос очереди
+	BackpressureError                          // вернуть ErrQueueFull
+)
+
+// Future результат асинхронной отправки запроса.
+type Future struct {
+	done chan struct{}
+	err  error
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+func (f *Future) resolve(err error) {
+	f.err = err
+	close(f.done)
+}
+
+// Done закрывается, когда запрос отправлен или отброшен.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err возвращает результат отправки. До закрытия Done возвращает nil.
+func (f *Future) Err() error {
+	select {
+	case <-f.done:
+		return f.err
+	default:
+		return nil
+	}
+}
+
+// Wait ждет результата отправки или отмены ctx.
+func (f *Future) Wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type asyncItem struct {
+	req    Request
+	send   func(cli Client) error // вызов клиента, которым отправляется req
+	future *Future
+}
+
+// AsyncClient реализует Client, отправляя события и конверсии в фоне
+// ограниченным пулом воркеров. Методы отправки ставят запрос в очередь
+// и сразу возвращают управление, результат можно получить через
+// колбек AsyncWithResultCallback или Future из Submit.
+// Создание кликов выполняется синхронно, т.к. вызывающему нужен clickID.
+//
+// DryRun, SetLogger, SetRetryPolicy, SetRateLimiter и Use ждут завершения
+// отправляемых воркерами запросов и действуют на следующие запросы.
+// Обращаться к обернутому клиенту напрямую, пока работают воркеры, нельзя.
+type AsyncClient struct {
+	cli          Client
+	workers      int
+	backpressure Backpressure
+	onResult     func(req Request, err error)
+
+	queue chan *asyncItem
+	quit  chan struct{} // будит заблокированных отправителей при закрытии
+	stop  chan struct{} // очередь больше не пополняется, воркеры дочитывают ее
+	wg    sync.WaitGroup
+
+	cliMu sync.RWMutex // настройка cli не пересекается с отправкой
+
+	sendMu    sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+	dropMu    sync.Mutex
+
+	pendingMu sync.Mutex
+	pending   int
+	idle      []chan struct{}
+}
+
+// AsyncOption настройка AsyncClient
+type AsyncOption func(a *AsyncClient)
+
+// AsyncWithWorkers задает число воркеров, отправляющих запросы.
+func AsyncWithWorkers(n int) AsyncOption {
+	return func(a *AsyncClient) {
+		if n > 0 {
+			a.workers = n
+		}
+	}
+}
+
+// AsyncWithQueueSize задает размер очереди запросов.
+func AsyncWithQueueSize(n int) AsyncOption {
+	return func(a *AsyncClient) {
+		if n > 0 {
+			a.queue = make(chan *asyncItem, n)
+		}
+	}
+}
+
+// AsyncWithBackpressure задает поведение при заполненной очереди.
+func AsyncWithBackpressure(mode Backpressure) AsyncOption {
+	return func(a *AsyncClient) {
+		a.backpressure = mode
+	}
+}
+
+// AsyncWithResultCallback задает колбек, вызываемый воркером после отправки каждого запроса.
+func AsyncWithResultCallback(f func(req Request, err error)) AsyncOption {
+	return func(a *AsyncClient) {
+		a.onResult = f
+	}
+}
+
+// NewAsyncClient создает AsyncClient поверх cli и запускает воркеры.
+// По умолчанию 4 воркера, очередь на 1024 запроса и BackpressureBlock.
+func NewAsyncClient(cli Client, opts ...AsyncOption) *AsyncClient {
+	a := &AsyncClient{
+		cli:          cli,
+		workers:      4,
+		backpressure: BackpressureBlock,
+		queue:        make(chan *asyncItem, 1024),
+		quit:         make(chan struct{}),
+		stop:         make(chan struct{}),
+	}
+	for _, f := range opts {
+		f(a)
+	}
+
+	a.wg.Add(a.workers)
+	for i := 0; i < a.workers; i++ {
+		go a.work()
+	}
+
+	return a
+}
+
+func (a *AsyncClient) work() {
+	defer a.wg.Done()
+	for {
+		select {
+		case item := <-a.queue:
+			a.process(item)
+		case <-a.stop:
+			// дочитываем то, что успели поставить до закрытия
+			for {
+				select {
+				case item := <-a.queue:
+					a.process(item)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *AsyncClient) process(item *asyncItem) {
+	a.cliMu.RLock()
+	err := item.send(a.cli)
+	a.cliMu.RUnlock()
+	a.complete(item, err)
+}
+
+// configure изменяет настройки cli, когда воркеры ничего не отправляют
+func (a *AsyncClient) configure(f func(cli Client)) {
+	a.cliMu.Lock()
+	defer a.cliMu.Unlock()
+	f(a.cli)
+}
+
+func (a *AsyncClient) complete(item *asyncItem, err error) {
+	if a.onResult != nil {
+		a.onResult(item.req, err)
+	}
+	item.future.resolve(err)
+
+	a.pendingMu.Lock()
+	defer a.pendingMu.Unlock()
+	a.pending--
+	if a.pending == 0 {
+		for _, ch := range a.idle {
+			close(ch)
+		}
+		a.idle = nil
+	}
+}
+
+// Submit ставит запрос в очередь и возвращает Future с результатом его отправки.
+func (a *AsyncClient) Submit(req Request, opts ...sendClickOpt) (*Future, error) {
+	return a.submit(req, func(cli Client) error {
+		return cli.SendPostbackRequest(req, opts...)
+	})
+}
+
+func (a *AsyncClient) submit(req Request, send func(cli Client) error) (*Future, error) {
+	item := &asyncItem{req: req, send: send, future: newFuture()}
+	if err := a.enqueue(item); err != nil {
+		return nil, err
+	}
+
+	return item.future, nil
+}
+
+func (a *AsyncClient) enqueue(item *asyncItem) error {
+	a.sendMu.RLock()
+	defer a.sendMu.RUnlock()
+
+	if a.closed {
+		return ErrAsyncClosed
+	}
+
+	a.pendingMu.Lock()
+	a.pending++
+	a.pendingMu.Unlock()
+
+	switch a.backpressure {
+	case BackpressureError:
+		select {
+		case a.queue <- item:
+			return nil
+		default:
+			a.complete(item, ErrQueueFull)
+			return ErrQueueFull
+		}
+	case BackpressureDropOldest:
+		a.dropMu.Lock()
+		defer a.dropMu.Unlock()
+		for {
+			select {
+			case a.queue <- item:
+				return nil
+			default:
+			}
+			select {
+			case oldest := <-a.queue:
+				a.complete(oldest, ErrRequestDropped)
+			default:
+			}
+		}
+	default:
+		select {
+		case a.queue <- item:
+			return nil
+		case <-a.quit:
+			a.complete(item, ErrAsyncClosed)
+			return ErrAsyncClosed
+		}
+	}
+}
+
+// Flush ждет, пока будут отправлены все поставленные в очередь запросы.
+func (a *AsyncClient) Flush(ctx context.Context) error {
+	a.pendingMu.Lock()
+	if a.pending == 0 {
+		a.pendingMu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	a.idle = append(a.idle, ch)
+	a.pendingMu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close перестает принимать запросы, отправляет оставшиеся в очереди
+// и останавливает воркеры. Если ctx отменен раньше, воркеры продолжат работу в фоне.
+func (a *AsyncClient) Close(ctx context.Context) error {
+	a.closeOnce.Do(func() {
+		close(a.quit)
+		a.sendMu.Lock()
+		a.closed = true
+		a.sendMu.Unlock()
+		close(a.stop)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SendEvents ставит в очередь обновление клика событиями
+func (a *AsyncClient) SendEvents(clickID string, events Events, opts ...sendClickOpt) error {
+	_, err := a.submit(&request{clickID: clickID, events: events}, func(cli Client) error {
+		return cli.SendEvents(clickID, events, opts...)
+	})
+	return err
+}
+
+// SendEvent ставит в очередь отправку события
+func (a *AsyncClient) SendEvent(clickID string, event Event, opts ...sendClickOpt) error {
+	events := Events{}
+	if err := events.Set(event, false); err != nil {
+		return err
+	}
+
+	return a.SendEvents(clickID, events, opts...)
+}
+
+// AddEvent ставит в очередь добавление к событию index единицы
+func (a *AsyncClient) AddEvent(clickID string, index uint8, opts ...sendClickOpt) error {
+	return a.SendEvent(clickID, binom.AddEvent(int8(index), 1), opts...)
+}
+
+// SubEvent ставит в очередь вычитание у события index единицы
+func (a *AsyncClient) SubEvent(clickID string, index uint8, opts ...sendClickOpt) error {
+	return a.SendEvent(clickID, binom.AddEvent(int8(index), -1), opts...)
+}
+
+// SetupEvent ставит в очередь установку события index в единицу
+func (a *AsyncClient) SetupEvent(clickID string, index uint8, opts ...sendClickOpt) error {
+	return a.SendEvent(clickID, binom.Event(int8(index), 1), opts...)
+}
+
+// ResetEvent ставит в очередь установку события index в ноль
+func (a *AsyncClient) ResetEvent(clickID string, index uint8, opts ...sendClickOpt) error {
+	return a.SendEvent(clickID, binom.Event(int8(index), 0), opts...)
+}
+
+// AddNamedEvent ставит в очередь добавление val к событию name, см. Client.AddNamedEvent
+func (a *AsyncClient) AddNamedEvent(clickID string, name string, val int64, opts ...sendClickOpt) error {
+	ev, err := a.eventRegistry().AddEvent(name, val)
+	if err != nil {
+		return err
+	}
+
+	return a.SendEvent(clickID, ev, opts...)
+}
+
+// SetNamedEvent ставит в очередь установку события name в val, см. Client.SetNamedEvent
+func (a *AsyncClient) SetNamedEvent(clickID string, name string, val int64, opts ...sendClickOpt) error {
+	ev, err := a.eventRegistry().Event(name, val)
+	if err != nil {
+		return err
+	}
+
+	return a.SendEvent(clickID, ev, opts...)
+}
+
+func (a *AsyncClient) eventRegistry() *EventRegistry {
+	return eventRegistryOf(a.cli)
+}
+
+// SendPostbackRequest ставит в очередь postback запрос
+func (a *AsyncClient) SendPostbackRequest(postback Request, opts ...sendClickOpt) error {
+	_, err := a.Submit(postback, opts...)
+	return err
+}
+
+// SendPostback ставит в очередь конверсию, см. Client.SendPostback
+func (a *AsyncClient) SendPostback(clickID string, status *string, payout *Money, events Events, opts ...sendClickOpt) error {
+	req := &request{
+		clickID:   clickID,
+		cnvStatus: status,
+		events:    events,
+		isCnv:     true,
+	}
+	if payout != nil {
+		p := *payout
+		payout = &p
+		req.setPayout(p)
+	}
+	_, err := a.submit(req, func(cli Client) error {
+		return cli.SendPostback(clickID, status, payout, events, opts...)
+	})
+
+	return err
+}
+
+// SendBaseClick синхронно создает базовый клик, см. Client.SendBaseClick
+func (a *AsyncClient) SendBaseClick(campaignKey string, lpbcid bool, opts ...sendClickOpt) (string, error) {
+	a.cliMu.RLock()
+	defer a.cliMu.RUnlock()
+
+	return a.cli.SendBaseClick(campaignKey, lpbcid, opts...)
+}
+
+// SetLPClick синхронно устанавливает клик по лендингу, см. Client.SetLPClick
+func (a *AsyncClient) SetLPClick(clickID string, opts ...sendClickOpt) (string, error) {
+	a.cliMu.RLock()
+	defer a.cliMu.RUnlock()
+
+	return a.cli.SetLPClick(clickID, opts...)
+}
+
+// SendClick синхронно производит клик по офферу, см. Client.SendClick
+func (a *AsyncClient) SendClick(clickID string, toOffer uint64, opts ...sendClickOpt) (string, error) {
+	a.cliMu.RLock()
+	defer a.cliMu.RUnlock()
+
+	return a.cli.SendClick(clickID, toOffer, opts...)
+}
+
+func (a *AsyncClient) DryRun() {
+	a.configure(func(cli Client) { cli.DryRun() })
+}
+
+func (a *AsyncClient) SetLogger(log Logger) {
+	a.configure(func(cli Client) { cli.SetLogger(log) })
+}
+
+func (a *AsyncClient) SetRetryPolicy(policy RetryPolicy) {
+	a.configure(func(cli Client) { cli.SetRetryPolicy(policy) })
+}
+
+func (a *AsyncClient) SetRateLimiter(limiter *RateLimiter) {
+	a.configure(func(cli Client) { cli.SetRateLimiter(limiter) })
+}
+
+// Use добавляет перехватчики в цепочку клиента, см. Client.Use.
+// Перехватчики вызываются в воркерах.
+func (a *AsyncClient) Use(interceptors ...Interceptor) {
+	a.configure(func(cli Client) { cli.Use(interceptors...) })
+}
@@ -0,0 +1,241 @@
+package binomv2postback
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+// kindMetrics запоминает вызовы клиента, учтенные в метриках
+type kindMetrics struct {
+	mu    sync.Mutex
+	kinds []string
+}
+
+func (m *kindMetrics) ObserveRequest(kind, result string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kinds = append(m.kinds, kind)
+}
+
+func (m *kindMetrics) ObserveLatency(host string, latency time.Duration) {}
+func (m *kindMetrics) AddInFlight(host string, delta int)                {}
+func (m *kindMetrics) ObserveDryRun(kind string)                         {}
+
+func TestAsyncClientKinds(t *testing.T) {
+	metrics := &kindMetrics{}
+	a := NewAsyncClient(newDedupTestClient(t, &dedupTracker{}, WithMetrics(metrics)))
+	status := "approved"
+	payout, _ := ParseMoney("1", "")
+	events := Events{}
+	events.Set(binom.Event(1, 1), false)
+
+	if err := a.SendEvents("c1", events); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SendPostback("c2", &status, &payout, Events{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SendPostbackRequest(NewRequestBuilder().WithStatus(status).Request("c3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(metrics.kinds)
+	want := []string{MetricsKindSendEvents, MetricsKindSendPostback, MetricsKindSendPostbackRequest}
+	if len(metrics.kinds) != len(want) {
+		t.Fatalf("kinds = %v, want %v", metrics.kinds, want)
+	}
+	for i := range want {
+		if metrics.kinds[i] != want[i] {
+			t.Errorf("kinds = %v, want %v", metrics.kinds, want)
+		}
+	}
+}
+
+func TestAsyncClientDrainsOnClose(t *testing.T) {
+	tr := &dedupTracker{}
+	var results atomic.Int32
+	a := NewAsyncClient(newDedupTestClient(t, tr),
+		AsyncWithWorkers(3),
+		AsyncWithResultCallback(func(req Request, err error) {
+			if err == nil {
+				results.Add(1)
+			}
+		}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := a.SendEvent("c1", binom.Event(1, 1)); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := tr.requests.Load(); n != 100 {
+		t.Errorf("sent %d requests, want 100", n)
+	}
+	if n := results.Load(); n != 100 {
+		t.Errorf("%d results, want 100", n)
+	}
+	if err := a.SendEvent("c1", binom.Event(1, 1)); !errors.Is(err, ErrAsyncClosed) {
+		t.Errorf("send after Close: %v", err)
+	}
+}
+
+func TestAsyncClientFlush(t *testing.T) {
+	release := make(chan struct{})
+	tr := TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		<-release
+		return &TransportResponse{StatusCode: http.StatusOK}, nil
+	})
+	a := NewAsyncClient(newDedupTestClient(t, tr), AsyncWithWorkers(1))
+	defer a.Close(context.Background())
+
+	future, err := a.Submit(NewRequestBuilder().WithStatus("approved").Request("c1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := a.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Flush with a request in flight: %v", err)
+	}
+	if err := future.Err(); err != nil {
+		t.Errorf("Err before completion = %v", err)
+	}
+
+	close(release)
+	if err := a.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := future.Wait(context.Background()); err != nil {
+		t.Errorf("future: %v", err)
+	}
+}
+
+func TestAsyncClientBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	tr := TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return &TransportResponse{StatusCode: http.StatusOK}, nil
+	})
+	req := NewRequestBuilder().WithStatus("approved").Request("c1")
+
+	// воркер занят первым запросом, второй занимает очередь на один запрос
+	a := NewAsyncClient(newDedupTestClient(t, tr), AsyncWithWorkers(1), AsyncWithQueueSize(1), AsyncWithBackpressure(BackpressureError))
+	a.Submit(req)
+	<-started
+	a.Submit(req)
+	if _, err := a.Submit(req); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("BackpressureError: %v", err)
+	}
+
+	b := NewAsyncClient(newDedupTestClient(t, tr), AsyncWithWorkers(1), AsyncWithQueueSize(1), AsyncWithBackpressure(BackpressureDropOldest))
+	b.Submit(req)
+	<-started
+	oldest, _ := b.Submit(req)
+	newest, err := b.Submit(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := oldest.Wait(context.Background()); !errors.Is(err, ErrRequestDropped) {
+		t.Errorf("oldest request: %v", err)
+	}
+
+	close(release)
+	if err := newest.Wait(context.Background()); err != nil {
+		t.Errorf("newest request: %v", err)
+	}
+	for _, c := range []*AsyncClient{a, b} {
+		if err := c.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAsyncClientBlockedSenderOnClose(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	tr := TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return &TransportResponse{StatusCode: http.StatusOK}, nil
+	})
+	a := NewAsyncClient(newDedupTestClient(t, tr), AsyncWithWorkers(1), AsyncWithQueueSize(1))
+	req := NewRequestBuilder().WithStatus("approved").Request("c1")
+	a.Submit(req)
+	<-started
+	a.Submit(req)
+
+	blocked := make(chan error)
+	go func() {
+		_, err := a.Submit(req)
+		blocked <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	closed := make(chan error)
+	go func() {
+		closed <- a.Close(context.Background())
+	}()
+	if err := <-blocked; !errors.Is(err, ErrAsyncClosed) {
+		t.Errorf("blocked sender: %v", err)
+	}
+	close(release)
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsyncClientConfigureWhileSending(t *testing.T) {
+	tr := &dedupTracker{}
+	a := NewAsyncClient(newDedupTestClient(t, tr), AsyncWithWorkers(4))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			a.SendEvent("c1", binom.Event(1, 1))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			a.SetRetryPolicy(RetryPolicy{})
+			a.SetRateLimiter(nil)
+			a.SetLogger(nil)
+			a.Use(func(next Sender) Sender { return next })
+		}
+		a.DryRun()
+	}()
+	wg.Wait()
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,137 @@
+package binomv2postback
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ErrNoClickIDInResponse трекер не вернул clickID ни в редиректе, ни в JSON-ответе
+var ErrNoClickIDInResponse = errors.New("click id not found in tracker response")
+
+// ClickClient создает клики в трекере. Все методы возвращают clickID,
+// который присвоил клику Binom. В режиме dry-run запрос не отправляется
+// и методы возвращают пустой clickID без ошибки.
+type ClickClient interface {
+	// создание базового клика по кампании
+	SendBaseClick(campaignKey string, lpbcid bool, opts ...sendClickOpt) (string, error)
+	// клик по лендингу для существующего клика
+	SetLPClick(clickID string, opts ...sendClickOpt) (string, error)
+	// клик по офферу с номером toOffer в пути (0 - оффер выбирает трекер)
+	SendClick(clickID string, toOffer uint64, opts ...sendClickOpt) (string, error)
+}
+
+// clickIDParams имена аргументов, в которых Binom может вернуть clickID
+// в редиректе или полей JSON-ответа.
+var clickIDParams = []string{"clickid", "click_id", "cnv_id", "uclick", "subid"}
+
+// SendBaseClick отправляет базовый клик на компанию с ключем campaignKey.
+// если установлен lpbcid=true, то так же устанавливает LPClick.
+func (cli *client) SendBaseClick(campaignKey string, lpbcid bool, opts ...sendClickOpt) (string, error) {
+	if campaignKey == "" {
+		return "", fmt.Errorf("empty campaign key")
+	}
+	q := make(url.Values)
+	q.Add("key", campaignKey)
+	if lpbcid {
+		q.Add("lpbcid", "1")
+	}
+
+	return cli.createClick(q, opts...)
+}
+
+// SetLPClick устанавливает клик по лендингу для клика clickID.
+func (cli *client) SetLPClick(clickID string, opts ...sendClickOpt) (string, error) {
+	if clickID == "" {
+		return "", fmt.Errorf("empty click id")
+	}
+	q := make(url.Values)
+	q.Add("lpbcid", clickID)
+
+	return cli.createClick(q, opts...)
+}
+
+// SendClick производит клик по офферу для клика clickID.
+// toOffer - порядковый номер оффера в пути, при 0 оффер выбирает трекер.
+func (cli *client) SendClick(clickID string, toOffer uint64, opts ...sendClickOpt) (string, error) {
+	if clickID == "" {
+		return "", fmt.Errorf("empty click id")
+	}
+	q := make(url.Values)
+	q.Add("lp", "1")
+	q.Add("uclick", clickID)
+	if toOffer > 0 {
+		q.Add("to_offer", strconv.FormatUint(toOffer, 10))
+	}
+
+	return cli.createClick(q, opts...)
+}
+
+// createClick отправляет запрос на создание клика, авторизуя его apiKey,
+// и достает из ответа clickID. В dry-run возвращает пустой clickID.
+func (cli *client) createClick(q url.Values, opts ...sendClickOpt) (string, error) {
+	if cli.apiKey != "" {
+		q.Set("api_key", cli.apiKey)
+	}
+	opts = append([]sendClickOpt{optNoRedirect()}, opts...)
+
+	resp, err := cli.doClick(q.Encode(), opts...)
+	if err != nil {
+		return "", err
+	}
+	if resp.DryRun {
+		return "", nil
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", resp.statusError()
+	}
+
+	clickID := clickIDFromResponse(resp)
+	if clickID == "" {
+		return "", fmt.Errorf("%w: %s, status code: %d", ErrNoClickIDInResponse, resp.RedactedURL, resp.StatusCode)
+	}
+
+	return clickID, nil
+}
+
+func optNoRedirect() sendClickOpt {
+	return func(cli *client, clkReq *clickReq) error {
+		clkReq.noRedirect = true
+		return nil
+	}
+}
+
+// clickIDFromResponse ищет clickID в аргументах адреса редиректа, затем в полях
+// JSON-объекта ответа. Текст ответа clickID не считается: Binom отвечает так
+// и на ошибки ("ok", "banned"), поэтому без clickID возвращается пустая строка.
+func clickIDFromResponse(resp *clickResp) string {
+	if location := resp.Header.Get("Location"); location != "" {
+		if u, err := url.Parse(location); err == nil {
+			q := u.Query()
+			for _, name := range clickIDParams {
+				if v := q.Get(name); v != "" {
+					return v
+				}
+			}
+		}
+	}
+
+	data, ok := responseJSON(resp.Body)
+	if !ok {
+		return ""
+	}
+	for _, name := range clickIDParams {
+		switch v := data[name].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,118 @@
+package binomv2postback
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// newClickTestClient создает клиент, который отвечает на запросы ответом resp
+// и сохраняет последний запрос в last
+func newClickTestClient(t *testing.T, resp *TransportResponse, last **TransportRequest) Client {
+	t.Helper()
+	cli, err := New(
+		WithClickBaseURL("https://binom.example/click.php"),
+		WithAPIKey("secret"),
+		WithRetryPolicy(RetryPolicy{}),
+		WithTransport(TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+			*last = req
+			return resp, nil
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cli
+}
+
+func TestCreateClickResponses(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *TransportResponse
+		want string
+	}{
+		{"redirect", &TransportResponse{StatusCode: http.StatusFound, Header: http.Header{"Location": {"https://lp.example/?clickid=abc123&x=1"}}}, "abc123"},
+		{"redirect subid", &TransportResponse{StatusCode: http.StatusFound, Header: http.Header{"Location": {"https://lp.example/?subid=s1"}}}, "s1"},
+		{"json", &TransportResponse{StatusCode: http.StatusOK, Body: []byte(`{"clickid": "j1"}`)}, "j1"},
+		{"json number", &TransportResponse{StatusCode: http.StatusOK, Body: []byte(`{"click_id": 42}`)}, "42"},
+	}
+	for _, tt := range tests {
+		var last *TransportRequest
+		cli := newClickTestClient(t, tt.resp, &last)
+		got, err := cli.SendBaseClick("camp", false)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: SendBaseClick = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+		if last == nil || last.FollowRedirects {
+			t.Errorf("%s: click request follows redirects", tt.name)
+		}
+	}
+}
+
+func TestCreateClickNoClickID(t *testing.T) {
+	for _, body := range []string{"ok", "banned", "error", "", `{"clickid": ""}`, "<html>click</html>"} {
+		var last *TransportRequest
+		cli := newClickTestClient(t, &TransportResponse{StatusCode: http.StatusOK, Body: []byte(body)}, &last)
+		got, err := cli.SendBaseClick("camp", false)
+		if !errors.Is(err, ErrNoClickIDInResponse) || got != "" {
+			t.Errorf("body %q: SendBaseClick = %q, %v, want ErrNoClickIDInResponse", body, got, err)
+		}
+	}
+
+	var last *TransportRequest
+	cli := newClickTestClient(t, &TransportResponse{StatusCode: http.StatusForbidden, Body: []byte("forbidden")}, &last)
+	_, err := cli.SendBaseClick("camp", false)
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("403: %v", err)
+	}
+}
+
+func TestCreateClickQuery(t *testing.T) {
+	redirect := &TransportResponse{StatusCode: http.StatusFound, Header: http.Header{"Location": {"/?clickid=new"}}}
+	var last *TransportRequest
+	cli := newClickTestClient(t, redirect, &last)
+
+	tests := []struct {
+		name string
+		send func() (string, error)
+		want url.Values
+	}{
+		{"base click", func() (string, error) { return cli.SendBaseClick("camp", true) },
+			url.Values{"key": {"camp"}, "lpbcid": {"1"}, "api_key": {"secret"}}},
+		{"lp click", func() (string, error) { return cli.SetLPClick("c1") },
+			url.Values{"lpbcid": {"c1"}, "api_key": {"secret"}}},
+		{"offer click", func() (string, error) { return cli.SendClick("c1", 2) },
+			url.Values{"lp": {"1"}, "uclick": {"c1"}, "to_offer": {"2"}, "api_key": {"secret"}}},
+	}
+	for _, tt := range tests {
+		if _, err := tt.send(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := last.URL.Query(); got.Encode() != tt.want.Encode() {
+			t.Errorf("%s: query = %s, want %s", tt.name, got.Encode(), tt.want.Encode())
+		}
+	}
+
+	if _, err := cli.SendBaseClick("", false); err == nil {
+		t.Error("empty campaign key accepted")
+	}
+	if _, err := cli.SendClick("", 0); err == nil {
+		t.Error("empty click id accepted")
+	}
+}
+
+func TestCreateClickDryRun(t *testing.T) {
+	var last *TransportRequest
+	cli := newClickTestClient(t, &TransportResponse{StatusCode: http.StatusOK}, &last)
+	got, err := cli.SendBaseClick("camp", false, OptDryRun())
+	if err != nil || got != "" {
+		t.Errorf("dry-run SendBaseClick = %q, %v, want empty click id", got, err)
+	}
+	if last != nil {
+		t.Error("dry-run request sent")
+	}
+}
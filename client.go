@@ -2,11 +2,14 @@ package binomv2postback
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/CLi-Ter/binomv2-postback/binom"
 )
@@ -20,19 +23,26 @@ type EventClient interface {
 	SubEvent(clickID string, index uint8, opts ...sendClickOpt) error
 	SetupEvent(clickID string, index uint8, opts ...sendClickOpt) error
 	ResetEvent(clickID string, index uint8, opts ...sendClickOpt) error
+	// работа с событиями по именам из EventRegistry
+	AddNamedEvent(clickID string, name string, val int64, opts ...sendClickOpt) error
+	SetNamedEvent(clickID string, name string, val int64, opts ...sendClickOpt) error
 }
 
 type PostbackClient interface {
 	SendPostbackRequest(postback Request, opts ...sendClickOpt) error
-	SendPostback(clickID string, status *string, payout *float64, events Events, opts ...sendClickOpt) error
+	SendPostback(clickID string, status *string, payout *Money, events Events, opts ...sendClickOpt) error
 }
 
 // Client это клиент для трекера Binom позволяющий работать с кликом.
 type Client interface {
+	ClickClient
 	EventClient
 	PostbackClient
 	DryRun()
 	SetLogger(log Logger)
+	SetRetryPolicy(policy RetryPolicy)
+	SetRateLimiter(limiter *RateLimiter)
+	Use(interceptors ...Interceptor)
 }
 
 type client struct {
@@ -41,15 +51,45 @@ type client struct {
 	apiKey               string  // API-ключ от Binom
 	updKey               *string // UPDKey из настроек Binom
 	log                  Logger
+	slog                 *slog.Logger
 	dontSendEmptyUpdates bool
-
-	httpClient *http.Client
+	emptyUpdateErr       bool // возвращать ErrEmptyUpdate для пропущенных обновлений
+	retry                RetryPolicy
+	limiter              *RateLimiter
+	timeout              time.Duration            // таймаут одной попытки запроса
+	hostTimeouts         map[string]time.Duration // таймауты для отдельных хостов
+	headers              http.Header              // заголовки каждого запроса
+	sensitiveParams      []string                 // аргументы, которые вырезаются из логов и ошибок
+	dryRunOut            io.Writer                // куда печатать запросы в режиме dryRun
+	metrics              Metrics
+	tracer               Tracer
+	events               *EventRegistry    // имена событий для AddNamedEvent и SetNamedEvent
+	statusModel          *StatusModel      // допустимые переходы статуса конверсии
+	statusStore          StatusStore       // последние статусы конверсий по кликам
+	statusLocks          clickLocks        // блокировки проверки статуса по кликам
+	normalizer           *PayoutNormalizer // перевод выплат в базовую валюту
+	payoutPrecision      int               // знаков после запятой в payout
+	interceptors         []Interceptor     // перехватчики Use
+	sender               Sender            // собранная цепочка перехватчиков
+
+	transport Transport
 }
 
 func (cli *client) SetLogger(log Logger) {
 	cli.log = log
 }
 
+// SetRetryPolicy устанавливает политику повторов для всех запросов клиента
+func (cli *client) SetRetryPolicy(policy RetryPolicy) {
+	cli.retry = policy
+}
+
+// SetRateLimiter ограничивает частоту запросов клиента к трекеру.
+// Один RateLimiter можно разделить между несколькими клиентами.
+func (cli *client) SetRateLimiter(limiter *RateLimiter) {
+	cli.limiter = limiter
+}
+
 // AddEvent добавляет к событию index единицу
 func (cli *client) AddEvent(clickID string, index uint8, opts ...sendClickOpt) error {
 	return cli.SendEvent(clickID, binom.AddEvent(int8(index), 1), opts...)
@@ -73,20 +113,19 @@ func (cli *client) ResetEvent(clickID string, index uint8, opts ...sendClickOpt)
 // NewClient создает новый клиент для Binom-трекера, у которого клик адрес расположен по clickBaseURL.
 // apiKey - нужен для создания базового клика, т.к. он создается в Binom через API.
 // updKey - нужен для обновления данных по клику (отправка событий), если он установлен в настройках Binom.
-func NewClient(clickBaseURL string, apiKey string, updKey string) Client {
-	var uk *string
-	if updKey != "" {
-		uk = &updKey
+// В отличие от New не проверяет clickBaseURL и не возвращает ошибки opts:
+// опция с недопустимым значением (например WithTimeout(-1)) и nil опция
+// не применяются и нигде не сообщаются. Чтобы получить ошибку, используйте New.
+func NewClient(clickBaseURL string, apiKey string, updKey string, opts ...ClientOption) Client {
+	cli := newClient()
+	opts = append([]ClientOption{WithClickBaseURL(clickBaseURL), WithAPIKey(apiKey), WithUPDKey(updKey)}, opts...)
+	for _, f := range opts {
+		if f != nil {
+			_ = f(cli)
+		}
 	}
-	return &client{
-		clickBaseURL: clickBaseURL,
-		apiKey:       apiKey,
-		updKey:       uk,
-
-		dontSendEmptyUpdates: true,
 
-		httpClient: &http.Client{},
-	}
+	return cli
 }
 
 func (cli *client) DryRun() {
@@ -98,7 +137,7 @@ type sendClickOpt func(cli *client, clkReq *clickReq) error
 func OptWithClickBaseURL(clickBaseURL string) sendClickOpt {
 	return func(cli *client, clkReq *clickReq) error {
 		if clkReq != nil && clkReq.log != nil {
-			clkReq.log.Debugf("Setup click request with clickBaseURL option: %s", clickBaseURL)
+			clkReq.log.Debugf("Setup click request with clickBaseURL option: %s", redactString(clickBaseURL, clkReq.sensitiveParams))
 		}
 		clkReq.clickBaseURL = clickBaseURL
 
@@ -155,15 +194,103 @@ type clickReq struct {
 	method       string
 	clickBaseURL string
 	dryRun       bool
+	noRedirect   bool
 	body         io.Reader
 	ctx          context.Context
 	log          Logger
+	retry        RetryPolicy
+	attempt      int           // номер текущей попытки
+	kind         string        // вызов клиента для метрик (MetricsKind*)
+	response     *Response     // куда сохранить ответ трекера, см. OptWithResponse
+	waited       time.Duration // ожидание ограничителя частоты в последней попытке
+
+	sensitiveParams []string
+
+	idempotencyKey string
+}
+
+// clickResp ответ трекера на запрос к обработчику клика.
+type clickResp struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Truncated  bool
+	DryRun     bool
+	URL        *url.URL
+	// URL без секретов для логов и ошибок
+	RedactedURL string
+}
+
+// setResponse сохраняет ответ трекера для OptWithResponse.
+func (clkReq *clickReq) setResponse(resp *Response) {
+	if clkReq.response != nil && resp != nil {
+		*clkReq.response = *resp
+	}
+}
+
+func (r *clickResp) statusError() *HTTPStatusError {
+	return &HTTPStatusError{
+		StatusCode: r.StatusCode,
+		URL:        r.RedactedURL,
+		Body:       string(r.Body),
+		Header:     r.Header,
+	}
 }
 
 // sendClick отправляет GET запрос в binom на обработчик клика.
 // Это может быть базовый клик, lp клик, клик по кампании
 // событие (если клик уже существует) или же конверсия.
-func (cli *client) sendClick(query string, opt ...sendClickOpt) error {
+// Неудачные попытки повторяются согласно политике повторов клиента.
+// При заданном Tracer отправка и каждая попытка попадают в отдельные span.
+func (cli *client) sendClick(kind string, query string, opt ...sendClickOpt) error {
+	clkReq, err := cli.newClickReq(opt...)
+	if err != nil {
+		return err
+	}
+	clkReq.kind = kind
+	policy := clkReq.retry
+	sendCtx, span := cli.startSpan(clkReq.ctx, SpanNameSend)
+	setSpanRequest(span, clkReq, query)
+
+	for attempt := 1; ; attempt++ {
+		clkReq.attempt = attempt
+		var attemptSpan Span
+		clkReq.ctx, attemptSpan = cli.startSpan(sendCtx, SpanNameAttempt)
+		attemptSpan.SetAttribute(TraceAttrAttempt, attempt)
+		start := time.Now()
+		resp, err := cli.roundTrip(clkReq, query)
+		// Получив ошибку или отказ в теле ответа, возвращаем содержимое ответа как ошибку
+		if err == nil {
+			var response *Response
+			response, err = resp.response()
+			clkReq.setResponse(response)
+		}
+		if resp != nil && !resp.DryRun {
+			attemptSpan.SetAttribute(TraceAttrHTTPStatus, resp.StatusCode)
+			span.SetAttribute(TraceAttrHTTPStatus, resp.StatusCode)
+		}
+		attemptSpan.End(err)
+		final := err == nil || attempt >= policy.attempts() || !policy.retryable(clkReq.ctx, resp, err)
+		cli.logAttempt(clkReq, query, resp, err, time.Since(start), final)
+		if final {
+			span.SetAttribute(TraceAttrAttempt, attempt)
+			span.End(err)
+			return err
+		}
+		delay := policy.delay(attempt, resp)
+		if clkReq.log != nil {
+			clkReq.log.Infof("Binom request attempt %d/%d failed: %v. Retry in %s", attempt, policy.attempts(), err, delay)
+		}
+		if werr := sleepContext(clkReq.ctx, delay); werr != nil {
+			span.SetAttribute(TraceAttrAttempt, attempt)
+			span.End(err)
+			return err
+		}
+	}
+}
+
+// newClickReq собирает параметры запроса из настроек клиента и опций.
+func (cli *client) newClickReq(opt ...sendClickOpt) (*clickReq, error) {
 	clkReq := &clickReq{
 		method:       http.MethodGet,
 		clickBaseURL: cli.clickBaseURL,
@@ -171,73 +298,135 @@ func (cli *client) sendClick(query string, opt ...sendClickOpt) error {
 		body:         nil,
 		ctx:          nil,
 		log:          cli.log,
+		retry:        cli.retry,
+		attempt:      1,
+
+		sensitiveParams: cli.sensitiveParams,
 	}
 	for _, f := range opt {
 		if err := f(cli, clkReq); err != nil {
-			return err
+			return nil, err
 		}
 	}
+
+	return clkReq, nil
+}
+
+// doClick выполняет запрос к обработчику клика и возвращает ответ трекера как есть,
+// не проверяя код ответа. В режиме dryRun запрос не отправляется.
+func (cli *client) doClick(query string, opt ...sendClickOpt) (*clickResp, error) {
+	clkReq, err := cli.newClickReq(opt...)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := cli.roundTrip(clkReq, query)
+	cli.logAttempt(clkReq, query, resp, err, time.Since(start), true)
+
+	return resp, err
+}
+
+// roundTrip делает одну попытку запроса к трекеру.
+// Попытка пишется в лог вызывающим через logAttempt.
+func (cli *client) roundTrip(clkReq *clickReq, query string) (*clickResp, error) {
 	// Создаем GET HTTP-запрос
 	req, err := http.NewRequest(clkReq.method, clkReq.clickBaseURL, clkReq.body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if clkReq.ctx != nil {
 		req = req.WithContext(clkReq.ctx)
 	}
 	// добавляем параметры, в зависимости от них Binom понимает, что мы присылаем
 	req.URL.RawQuery = query
-	if clkReq.log != nil {
-		clkReq.log.Infof("Send binom request: %v", req)
+	for name, values := range cli.headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	if cli.tracer != nil && clkReq.ctx != nil {
+		cli.tracer.Inject(clkReq.ctx, req.Header)
 	}
 
 	if clkReq.dryRun {
-		fmt.Println("dryRun req URL:", req.URL.String())
-		return nil
+		cli.printDryRun(req.URL)
+		return &clickResp{DryRun: true, URL: req.URL, RedactedURL: cli.redactURL(req.URL)}, nil
 	}
 
-	// Отправляем запрос, ожидаем 200-ый ответ
-	response, err := cli.httpClient.Do(req)
+	ctx := clkReq.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	waited, err := cli.limiter.Wait(ctx, req.URL.Host)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer response.Body.Close()
+	clkReq.waited = waited
 
-	if clkReq.log != nil {
-		clkReq.log.Infof("Binom request: %v Response: %v", req, response)
+	timeout, ok := cli.hostTimeouts[req.URL.Host]
+	if !ok {
+		timeout = cli.timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
 	}
 
-	// Получив ошибку, пытаемся прочесть содержимое ответа и вернуть его как ошибку
-	if response.StatusCode != http.StatusOK {
-		var body []byte
-		_, err = response.Body.Read(body)
-		if err != nil {
-			return fmt.Errorf("failed to read response body: %v", err)
+	// Отправляем запрос, клик ID при создании клика приходит в редиректе,
+	// поэтому по нему не переходим
+	if cli.metrics != nil {
+		cli.metrics.AddInFlight(req.URL.Host, 1)
+	}
+	start := time.Now()
+	response, err := cli.transport.Send(&TransportRequest{Request: req, FollowRedirects: !clkReq.noRedirect})
+	if cli.metrics != nil {
+		cli.metrics.ObserveLatency(req.URL.Host, time.Since(start))
+		cli.metrics.AddInFlight(req.URL.Host, -1)
+	}
+	if err != nil {
+		var terr *TransportError
+		if errors.As(err, &terr) {
+			return nil, err
 		}
-		return fmt.Errorf("failed to send request, status code: %d, response %s", response.StatusCode, string(body))
+		return nil, &TransportError{URL: cli.redactURL(req.URL), Err: redactError(err, cli.sensitiveParams)}
+	}
+
+	// ограничение для транспортов, не ограничивающих чтение сами
+	body, truncated := response.Body, response.Truncated
+	if len(body) > MaxResponseBodySize {
+		body, truncated = body[:MaxResponseBodySize], true
 	}
 
-	return nil
+	return &clickResp{
+		StatusCode:  response.StatusCode,
+		Header:      response.Header,
+		Body:        body,
+		Truncated:   truncated,
+		URL:         req.URL,
+		RedactedURL: cli.redactURL(req.URL),
+	}, nil
 }
 
 // SendEvents обновляет клик событиями (конверсия не генерируется)
 func (cli *client) SendEvents(clickID string, events Events, opts ...sendClickOpt) error {
-	eventParams := events.URLParams()
-	// не посылать пустые события !!!
-	if cli.dontSendEmptyUpdates {
-		if eventParams == "" {
-			cli.log.Debugf("SendEvents>cli.dontSendEmptyUpdates: empty update")
-			return nil
-		}
-	}
+	return cli.send(cli.eventsCall(MetricsKindSendEvents, clickID, events, opts))
+}
 
+// eventsCall собирает запрос обновления клика событиями
+func (cli *client) eventsCall(kind string, clickID string, events Events, opts []sendClickOpt) *Call {
 	q := make(url.Values)
 	q.Add("upd_clickid", clickID)
 	if cli.updKey != nil {
 		q.Add("upd_key", *cli.updKey)
 	}
 
-	return cli.sendClick(q.Encode()+"&"+eventParams, opts...)
+	return &Call{
+		Kind:    kind,
+		ClickID: clickID,
+		Params:  append(strings.Split(q.Encode(), "&"), events.Params()...),
+		Options: opts,
+	}
 }
 
 // SendEvent отправляет (postback.AddEvent) или обновляет (postback.SetEvent)
@@ -252,55 +441,79 @@ func (cli *client) SendEvent(clickID string, event Event, opts ...sendClickOpt)
 }
 
 func (cli *client) SendPostbackRequest(postback Request, opts ...sendClickOpt) error {
-	// если это не конверсия, то отправляем через SendEvents, чтобы не триггерить postback в биноме
+	if cli.normalizer != nil {
+		var err error
+		if postback, err = cli.normalizer.NormalizeRequest(callContext(opts), postback); err != nil {
+			return err
+		}
+	}
+	// если это не конверсия, то отправляем как SendEvents, чтобы не триггерить postback в биноме
 	if !postback.IsConversion() {
-		return cli.SendEvents(postback.ClickID(), postback.Events(), opts...)
+		return cli.send(cli.eventsCall(MetricsKindSendPostbackRequest, postback.ClickID(), postback.Events(), opts))
 	}
 
-	return cli.sendClick(postback.URLParam(), opts...)
+	return cli.send(&Call{
+		Kind:    MetricsKindSendPostbackRequest,
+		ClickID: postback.ClickID(),
+		Params:  strings.Split(postback.URLParam(), "&"),
+		Options: opts,
+	})
 }
 
 // SendPostback отправляет/обновляет конверсию с cnv_id=clickID.
 // не обновляет статус конверсии, если status=nil
 // не обнволяет выплату, если payout=nil
 // во время конверсии можно добавить-заменить события через events
-func (cli *client) SendPostback(clickID string, status *string, payout *float64, events Events, opts ...sendClickOpt) error {
+func (cli *client) SendPostback(clickID string, status *string, payout *Money, events Events, opts ...sendClickOpt) error {
+	// выплата переводится в базовую валюту так же, как в SendPostbackRequest
+	if cli.normalizer != nil && payout != nil && payout.Currency() != "" {
+		converted, err := cli.normalizer.Convert(callContext(opts), *payout)
+		if err != nil {
+			return err
+		}
+		if cli.log != nil && converted.Currency() != payout.Currency() {
+			cli.log.Debugf("SendPostback payout of click %s converted: %s %s -> %s %s",
+				clickID, payout, payout.Currency(), converted, converted.Currency())
+		}
+		payout = &converted
+	}
 	q := make(url.Values)
 	q.Add("cnv_id", clickID)
 	if status != nil {
 		q.Add("cnv_status", *status)
 	}
 	if payout != nil {
-		q.Add("payout", fmt.Sprintf("%f", *payout))
-	}
-
-	var output []string
-	output = append(output, q.Encode())
-	eventsParams := events.URLParams()
-	if eventsParams != "" {
-		output = append(output, eventsParams)
+		q.Add("payout", payout.String())
+		if currency := payout.Currency(); currency != "" {
+			q.Add("cnv_currency", string(currency))
+		}
 	}
 
-	return cli.sendClick(strings.Join(output, "&"), opts...)
+	return cli.send(&Call{
+		Kind:    MetricsKindSendPostback,
+		ClickID: clickID,
+		Params:  append(strings.Split(q.Encode(), "&"), events.Params()...),
+		Options: opts,
+	})
 }
 
 // UpdatePayout implements Client.
-func (cli *client) UpdatePayout(clickID string, payout float64) error {
+func (cli *client) UpdatePayout(clickID string, payout Money) error {
 	return cli.SendPostback(clickID, nil, &payout, Events{})
 }
 
-// SendBaseClick отправляет базовый клик на компанию с ключем campaignKey.
-// если установлен lpbcid=true, то так же устанавливает LPClick.
-func (cli *client) SendBaseClick(campaignKey string, lpbcid bool) error {
-	panic("not implemented. coming in v0.9")
-}
-
-// SetLPClick устанавливает клик по лендингу для клика clickID.
-func (cli *client) SetLPClick(clickID string) error {
-	panic("not implemented. coming in v0.9")
+// redactURL возвращает URL запроса без значений ключей и других секретных аргументов
+func (cli *client) redactURL(u *url.URL) string {
+	return redactURLParams(u, cli.sensitiveParams)
 }
 
-// SendClick производит клик по офферу.
-func (cli *client) SendClick() error {
-	panic("not implemented. coming in v0.9")
+// printDryRun выводит не отправленный запрос в dryRunOut или логгер.
+// Без них запрос виден только в метриках и OptWithResponse (ResultDryRun).
+func (cli *client) printDryRun(u *url.URL) {
+	switch {
+	case cli.dryRunOut != nil:
+		fmt.Fprintln(cli.dryRunOut, "dryRun req URL:", cli.redactURL(u))
+	case cli.log != nil:
+		cli.log.Infof("dryRun req URL: %s", cli.redactURL(u))
+	}
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// checkpoint файл с ключами уже отправленных записей входного файла
+// (см. recordWriter), по одному ключу на строку. Позволяет продолжить
+// прерванную загрузку, даже если входной файл с тех пор дополнили.
+type checkpoint struct {
+	mu   sync.Mutex
+	file *os.File
+	sent map[string]bool
+}
+
+func openCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{sent: make(map[string]bool)}
+	if path == "" {
+		return cp, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if key := strings.TrimSpace(scanner.Text()); key != "" {
+				cp.sent[key] = true
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("read checkpoint: %w", err)
+		}
+	}
+
+	cp.file, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return cp, nil
+}
+
+// done сообщает, была ли запись с ключом key отправлена в прошлых запусках
+func (cp *checkpoint) done(key string) bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	return cp.sent[key]
+}
+
+// mark записывает запись с ключом key как отправленную
+func (cp *checkpoint) mark(key string) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cp.sent[key] = true
+	if cp.file == nil {
+		return nil
+	}
+	_, err := fmt.Fprintln(cp.file, key)
+
+	return err
+}
+
+func (cp *checkpoint) Close() error {
+	if cp.file == nil {
+		return nil
+	}
+
+	return cp.file.Close()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	binomv2postback "github.com/CLi-Ter/binomv2-postback"
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+const (
+	formatCSV   = "csv"
+	formatJSONL = "jsonl"
+	formatColon = "colon"
+)
+
+// record запрос из входного файла с номером строки
+type record struct {
+	line int
+	key  string // ключ запроса в checkpoint, см. recordWriter
+	req  binomv2postback.Request
+	err  error
+}
+
+// recordWriter передает прочитанные записи в out и назначает им ключи checkpoint:
+// хэш содержимого запроса и номер его повторения во входном файле.
+// Ключ не зависит от номера строки, поэтому добавленные или переставленные строки
+// не сбивают продолжение загрузки, а одинаковые строки (например add_event1=1)
+// отправляются столько раз, сколько встречаются.
+type recordWriter struct {
+	out  chan<- record
+	seen map[string]int
+}
+
+func (w *recordWriter) send(rec record) {
+	if rec.req != nil {
+		sum := sha256.Sum256([]byte(rec.req.URLParam()))
+		hash := hex.EncodeToString(sum[:16])
+		w.seen[hash]++
+		rec.key = hash + "/" + strconv.Itoa(w.seen[hash])
+	}
+	w.out <- rec
+}
+
+// detectFormat определяет формат по расширению файла
+func detectFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return formatCSV
+	case ".jsonl", ".json", ".ndjson":
+		return formatJSONL
+	}
+
+	return formatColon
+}
+
+// readRecords читает запросы из r в формате format и отправляет их в out.
+func readRecords(r io.Reader, format string, out chan<- record) error {
+	defer close(out)
+
+	w := &recordWriter{out: out, seen: make(map[string]int)}
+	switch format {
+	case formatCSV:
+		return readCSV(r, w)
+	case formatJSONL:
+		return readJSONL(r, w)
+	case formatColon:
+		scanner := binomv2postback.NewRequestScanner(r)
+		for scanner.Scan() {
+			req, err := scanner.Request()
+			w.send(record{line: scanner.Line(), req: req, err: err})
+		}
+		return scanner.Err()
+	}
+
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// readCSV читает CSV с заголовком из имен аргументов Binom:
+// cnv_id (или clickid), payout, cnv_status, cnv_status2, cnv_currency, eventN, add_eventN...
+func readCSV(r io.Reader, w *recordWriter) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("read csv header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// FieldPos нельзя вызывать после ошибки разбора, строка берется из ParseError
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return err
+			}
+			w.send(record{line: parseErr.StartLine, err: err})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		q := make(url.Values)
+		for i, value := range row {
+			if i < len(header) && value != "" {
+				q.Set(header[i], strings.TrimSpace(value))
+			}
+		}
+		req, err := binomv2postback.ParseQuery(q)
+		w.send(record{line: line, req: req, err: err})
+	}
+}
+
+// jsonRecord строка JSONL файла
+type jsonRecord struct {
+	ClickID  string                 `json:"click_id"`
+	Payout   *binomv2postback.Money `json:"payout"` // число разбирается без потери точности
+	Status   string                 `json:"cnv_status"`
+	Status2  []string               `json:"cnv_status2"`
+	Currency string                 `json:"cnv_currency"`
+	Events   map[string]int64       `json:"events"` // {"event1": 1, "add_event2": 3}
+}
+
+func readJSONL(r io.Reader, w *recordWriter) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var rec jsonRecord
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			w.send(record{line: line, err: err})
+			continue
+		}
+		req, err := rec.request()
+		w.send(record{line: line, req: req, err: err})
+	}
+
+	return scanner.Err()
+}
+
+func (rec jsonRecord) request() (binomv2postback.Request, error) {
+	if rec.ClickID == "" {
+		return nil, binomv2postback.ErrMissingClickID
+	}
+
+	builder := binomv2postback.NewRequestBuilder()
+	if rec.Payout != nil {
+		builder.WithPayoutMoney(*rec.Payout)
+	}
+	if rec.Status != "" {
+		builder.WithStatus(rec.Status, rec.Status2...)
+	}
+	if len(rec.Events) > 0 {
+		events := binomv2postback.Events{}
+		for name, value := range rec.Events {
+			ev, err := parseEvent(name, value)
+			if err != nil {
+				return nil, err
+			}
+			if err := events.Set(ev, false); err != nil {
+				return nil, err
+			}
+		}
+		builder.WithEvents(events)
+	}
+	if rec.Currency != "" {
+		builder.WithCurrency(binomv2postback.Currency(rec.Currency))
+	}
+
+	return builder.Build(rec.ClickID)
+}
+
+// parseEvent разбирает имя события eventN или add_eventN, N от 1 до MaxEventIndex
+func parseEvent(name string, value int64) (binomv2postback.Event, error) {
+	rest, add := strings.CutPrefix(name, "add_")
+	rest, ok := strings.CutPrefix(rest, "event")
+	if !ok {
+		return nil, fmt.Errorf("unknown event %q", name)
+	}
+	index, err := strconv.Atoi(rest)
+	if err != nil || strings.HasPrefix(rest, "+") || index < 1 || index > binomv2postback.MaxEventIndex {
+		return nil, fmt.Errorf("unknown event %q", name)
+	}
+	if add {
+		return binom.AddEvent(int8(index), value), nil
+	}
+
+	return binom.Event(int8(index), value), nil
+}
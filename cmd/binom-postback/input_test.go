@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"event1", "event1=5"},
+		{"add_event30", "add_event30=5"},
+		{"event12", "event12=5"},
+	}
+	for _, tt := range tests {
+		ev, err := parseEvent(tt.name, 5)
+		if err != nil || ev.URLParam() != tt.want {
+			t.Errorf("parseEvent(%q) = %v, %v, want %s", tt.name, ev, err, tt.want)
+		}
+	}
+	for _, name := range []string{"event1x", "event", "event0", "event31", "event-1", "event+1", "add_", "add_event", "add_add_event1", "Event1", "event 1", "payout"} {
+		if ev, err := parseEvent(name, 5); err == nil {
+			t.Errorf("parseEvent(%q) = %v, want error", name, ev)
+		}
+	}
+}
+
+func readAll(t *testing.T, input, format string) []record {
+	t.Helper()
+	out := make(chan record)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- readRecords(strings.NewReader(input), format, out)
+	}()
+	var recs []record
+	for rec := range out {
+		recs = append(recs, rec)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	return recs
+}
+
+func TestReadRecords(t *testing.T) {
+	tests := []struct {
+		format   string
+		input    string
+		wantLine int
+	}{
+		{formatCSV, "cnv_id,payout,cnv_status,event2\nc1,1.5,approved,3\nc2,x,,\n", 2},
+		{formatJSONL, `{"click_id": "c1", "payout": 1.5, "cnv_status": "approved", "events": {"event2": 3}}` + "\n\n" + `{"click_id": "c2", "events": {"event1x": 1}}` + "\n", 1},
+		{formatColon, "c1:payout=1.5:cnv_status=approved:event2=3\nc2:payout=x\n", 1},
+	}
+	for _, tt := range tests {
+		recs := readAll(t, tt.input, tt.format)
+		if len(recs) != 2 {
+			t.Fatalf("%s: %d records, want 2", tt.format, len(recs))
+		}
+		rec := recs[0]
+		if rec.err != nil || rec.line != tt.wantLine {
+			t.Errorf("%s: first record line %d: %v", tt.format, rec.line, rec.err)
+			continue
+		}
+		if got := rec.req.URLParam(); got != "cnv_id=c1&payout=1.5&cnv_status=approved&event2=3" {
+			t.Errorf("%s: request = %s", tt.format, got)
+		}
+		if rec.key == "" {
+			t.Errorf("%s: record without checkpoint key", tt.format)
+		}
+		if recs[1].err == nil {
+			t.Errorf("%s: invalid record accepted: %v", tt.format, recs[1].req)
+		}
+	}
+}
+
+func TestRecordKeys(t *testing.T) {
+	recs := readAll(t, "c1:add_event1=1\nc2:add_event1=1\nc1:add_event1=1\n", formatColon)
+	if len(recs) != 3 {
+		t.Fatalf("%d records", len(recs))
+	}
+	if recs[0].key == recs[2].key {
+		t.Errorf("repeated rows share the key %s", recs[0].key)
+	}
+	if recs[0].key == recs[1].key {
+		t.Error("different clicks share the key")
+	}
+
+	// ключ не зависит от номера строки
+	moved := readAll(t, "c3:event2=1\nc1:add_event1=1\n", formatColon)
+	if moved[1].key != recs[0].key {
+		t.Errorf("key changed with the line: %s != %s", moved[1].key, recs[0].key)
+	}
+}
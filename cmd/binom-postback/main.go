@@ -0,0 +1,164 @@
+// binom-postback загружает конверсии и события в Binom из CSV, JSONL
+// или файла в формате обновления конверсий Binom (clickid:payout=1:cnv_status=approved).
+//
+//	binom-postback -url https://binom.tracker/click -upd-key KEY -concurrency 8 -rate 50 conversions.csv
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	binomv2postback "github.com/CLi-Ter/binomv2-postback"
+)
+
+type options struct {
+	clickURL    string
+	apiKey      string
+	updKey      string
+	format      string
+	concurrency int
+	rate        float64
+	dryRun      bool
+	host        string
+	checkpoint  string
+	verbose     bool
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.clickURL, "url", os.Getenv("BINOM_CLICK_URL"), "click handler URL of the tracker (env BINOM_CLICK_URL)")
+	flag.StringVar(&opts.apiKey, "api-key", os.Getenv("BINOM_API_KEY"), "Binom API key (env BINOM_API_KEY)")
+	flag.StringVar(&opts.updKey, "upd-key", os.Getenv("BINOM_UPD_KEY"), "Binom UPD key (env BINOM_UPD_KEY)")
+	flag.StringVar(&opts.format, "format", "", "input format: csv, jsonl or colon (default: by file extension)")
+	flag.IntVar(&opts.concurrency, "concurrency", 4, "number of parallel requests")
+	flag.Float64Var(&opts.rate, "rate", 0, "max requests per second, 0 - unlimited")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "print requests instead of sending them")
+	flag.StringVar(&opts.host, "host", "", "override host of the click URL")
+	flag.StringVar(&opts.checkpoint, "checkpoint", "", "file with keys of sent records to resume from")
+	flag.BoolVar(&opts.verbose, "v", false, "print every failed request")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file]\n\nReads stdin if file is omitted or \"-\".\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	summary, err := run(ctx, opts, flag.Arg(0))
+	if summary != nil {
+		summary.print(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "binom-postback:", err)
+		os.Exit(2)
+	}
+	if summary.failed > 0 || summary.invalid > 0 {
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, opts options, path string) (*summary, error) {
+	if opts.clickURL == "" {
+		return nil, fmt.Errorf("click URL is required (-url or BINOM_CLICK_URL)")
+	}
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
+	}
+
+	var input io.Reader = os.Stdin
+	if path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		input = f
+	}
+	if opts.format == "" {
+		opts.format = detectFormat(path)
+	}
+
+	cp, err := openCheckpoint(opts.checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer cp.Close()
+
+	clientOpts := []binomv2postback.ClientOption{binomv2postback.WithDryRunWriter(os.Stdout)}
+	if opts.rate > 0 {
+		clientOpts = append(clientOpts, binomv2postback.WithRateLimit(binomv2postback.RateLimit{RequestsPerSecond: opts.rate, Burst: 1}))
+	}
+	cli := binomv2postback.NewClient(opts.clickURL, opts.apiKey, opts.updKey, clientOpts...)
+	var sendOpts binomv2postback.SendClickOptions
+	if opts.dryRun {
+		sendOpts = append(sendOpts, binomv2postback.OptDryRun())
+	}
+	if opts.host != "" {
+		sendOpts = append(sendOpts, binomv2postback.OptWithHost(opts.host))
+	}
+
+	records := make(chan record)
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- readRecords(input, opts.format, records)
+	}()
+
+	sum := &summary{started: time.Now()}
+	var wg sync.WaitGroup
+	wg.Add(opts.concurrency)
+	for i := 0; i < opts.concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for rec := range records {
+				if ctx.Err() != nil {
+					continue
+				}
+				if rec.err != nil {
+					sum.add(rec, resultInvalid, rec.err, opts.verbose)
+					continue
+				}
+				if cp.done(rec.key) {
+					sum.add(rec, resultSkipped, nil, opts.verbose)
+					continue
+				}
+				var resp binomv2postback.Response
+				reqOpts := append(binomv2postback.SendClickOptions{binomv2postback.OptWithContext(ctx), binomv2postback.OptWithResponse(&resp)}, sendOpts...)
+				err := cli.SendPostbackRequest(rec.req, reqOpts...)
+				if err != nil {
+					if ctx.Err() == nil {
+						sum.add(rec, resultFailed, err, opts.verbose)
+					}
+					continue
+				}
+				if !opts.dryRun {
+					if err := cp.mark(rec.key); err != nil {
+						fmt.Fprintf(os.Stderr, "line %d: failed to write checkpoint: %v\n", rec.line, err)
+					}
+				}
+				// пустое обновление (нечего отправлять) не считается ни отправленным, ни ошибкой
+				if resp.Result == binomv2postback.ResultSkipped {
+					sum.add(rec, resultSkipped, nil, opts.verbose)
+					continue
+				}
+				sum.add(rec, resultSent, nil, opts.verbose)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := <-readErr; err != nil {
+		return sum, fmt.Errorf("read input: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return sum, fmt.Errorf("interrupted, rerun with the same -checkpoint to resume: %w", err)
+	}
+
+	return sum, nil
+}
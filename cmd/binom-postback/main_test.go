@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// testTracker принимает запросы CLI и отвечает 500 на клики из failing
+type testTracker struct {
+	mu      sync.Mutex
+	clicks  []string
+	failing map[string]bool
+}
+
+func (tr *testTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	clickID := r.URL.Query().Get("cnv_id") + r.URL.Query().Get("upd_clickid")
+	if tr.failing[clickID] {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	tr.clicks = append(tr.clicks, clickID)
+}
+
+func (tr *testTracker) sent() []string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	clicks := tr.clicks
+	tr.clicks = nil
+
+	return clicks
+}
+
+func TestRunResumesFromCheckpoint(t *testing.T) {
+	tr := &testTracker{failing: map[string]bool{"c2": true}}
+	srv := httptest.NewServer(tr)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.txt")
+	opts := options{clickURL: srv.URL + "/click.php", checkpoint: filepath.Join(dir, "checkpoint"), concurrency: 2}
+	write := func(content string) {
+		if err := os.WriteFile(input, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("c1:cnv_status=approved\nc2:cnv_status=approved\nc3:add_event1=1\nc3:add_event1=1\nbad:payout=x\n")
+	sum, err := run(context.Background(), opts, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.sent != 3 || sum.failed != 1 || sum.invalid != 1 {
+		t.Errorf("first run: sent %d, failed %d, invalid %d", sum.sent, sum.failed, sum.invalid)
+	}
+	if n := len(tr.sent()); n != 3 {
+		t.Errorf("first run sent %d requests, want 3", n)
+	}
+
+	// во входной файл добавили строки в начало: отправленные записи не повторяются
+	tr.mu.Lock()
+	tr.failing = nil
+	tr.mu.Unlock()
+	write("c0:cnv_status=approved\nc1:cnv_status=approved\nc2:cnv_status=approved\nc3:add_event1=1\nc3:add_event1=1\nc3:add_event1=1\n")
+	sum, err = run(context.Background(), opts, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.sent != 3 || sum.skipped != 3 || sum.failed != 0 {
+		t.Errorf("second run: sent %d, skipped %d, failed %d", sum.sent, sum.skipped, sum.failed)
+	}
+	got := map[string]int{}
+	for _, clickID := range tr.sent() {
+		got[clickID]++
+	}
+	if len(got) != 3 || got["c0"] != 1 || got["c2"] != 1 || got["c3"] != 1 {
+		t.Errorf("second run sent %v, want c0, c2 and the third c3", got)
+	}
+}
+
+func TestRunRequiresURL(t *testing.T) {
+	if _, err := run(context.Background(), options{}, ""); err == nil {
+		t.Error("run without click URL succeeded")
+	}
+}
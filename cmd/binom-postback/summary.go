@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	resultSent    = "sent"
+	resultSkipped = "skipped"
+	resultFailed  = "failed"
+	resultInvalid = "invalid"
+)
+
+type failure struct {
+	line int
+	err  error
+}
+
+// summary итог загрузки
+type summary struct {
+	mu       sync.Mutex
+	started  time.Time
+	sent     int
+	skipped  int
+	failed   int
+	invalid  int
+	failures []failure
+}
+
+func (s *summary) add(rec record, result string, err error, verbose bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch result {
+	case resultSent:
+		s.sent++
+	case resultSkipped:
+		s.skipped++
+	case resultFailed:
+		s.failed++
+	case resultInvalid:
+		s.invalid++
+	}
+	if err != nil {
+		s.failures = append(s.failures, failure{line: rec.line, err: err})
+		if verbose {
+			fmt.Fprintf(os.Stderr, "line %d: %s: %v\n", rec.line, result, err)
+		}
+	}
+}
+
+func (s *summary) print(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(w, "sent: %d, skipped: %d, failed: %d, invalid: %d, took: %s\n",
+		s.sent, s.skipped, s.failed, s.invalid, time.Since(s.started).Round(time.Millisecond))
+	if len(s.failures) == 0 {
+		return
+	}
+
+	sort.Slice(s.failures, func(i, j int) bool {
+		return s.failures[i].line < s.failures[j].line
+	})
+	fmt.Fprintln(w, "failures:")
+	for _, f := range s.failures {
+		fmt.Fprintf(w, "  line %d: %v\n", f.line, f.err)
+	}
+}
@@ -0,0 +1,286 @@
+package binomv2postback
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+type coalesceBuf struct {
+	events Events
+	opts   []sendClickOpt
+	timer  *time.Timer
+}
+
+// CoalescingClient копит обновления событий одного клика в течение окна
+// и отправляет их одним upd_clickid запросом (см. Events.Merge).
+// Конверсии и создание кликов проходят в Client без задержки,
+// накопленные события клика отправляются вместе с конверсией.
+type CoalescingClient struct {
+	Client
+	window  time.Duration
+	log     Logger
+	onError func(clickID string, events Events, err error)
+
+	mu     sync.Mutex
+	bufs   map[string]*coalesceBuf
+	closed bool
+}
+
+// CoalesceOption настройка CoalescingClient
+type CoalesceOption func(c *CoalescingClient)
+
+// CoalesceWithLogger задает логгер для ошибок фоновой отправки.
+func CoalesceWithLogger(log Logger) CoalesceOption {
+	return func(c *CoalescingClient) {
+		c.log = log
+	}
+}
+
+// CoalesceWithErrorHandler задает обработчик накопленных событий, которые не будут
+// отправлены повторно: постоянная ошибка фоновой отправки или ошибка после Close.
+func CoalesceWithErrorHandler(f func(clickID string, events Events, err error)) CoalesceOption {
+	return func(c *CoalescingClient) {
+		c.onError = f
+	}
+}
+
+// NewCoalescingClient создает CoalescingClient поверх cli,
+// накапливающий обновления клика в течение window.
+func NewCoalescingClient(cli Client, window time.Duration, opts ...CoalesceOption) *CoalescingClient {
+	c := &CoalescingClient{
+		Client: cli,
+		window: window,
+		bufs:   make(map[string]*coalesceBuf),
+	}
+	for _, f := range opts {
+		f(c)
+	}
+
+	return c
+}
+
+// SendEvents добавляет события к накопленным для клика clickID.
+// Опции запроса берутся от первого обновления в окне.
+func (c *CoalescingClient) SendEvents(clickID string, events Events, opts ...sendClickOpt) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return c.Client.SendEvents(clickID, events, opts...)
+	}
+	buf, ok := c.bufs[clickID]
+	if !ok {
+		buf = &coalesceBuf{opts: opts}
+		buf.timer = time.AfterFunc(c.window, func() {
+			c.flushClick(clickID)
+		})
+		c.bufs[clickID] = buf
+	}
+	buf.events.Merge(events)
+	c.mu.Unlock()
+
+	return nil
+}
+
+// SendEvent добавляет событие к накопленным для клика clickID
+func (c *CoalescingClient) SendEvent(clickID string, event Event, opts ...sendClickOpt) error {
+	events := Events{}
+	if err := events.Set(event, false); err != nil {
+		return err
+	}
+
+	return c.SendEvents(clickID, events, opts...)
+}
+
+// AddEvent добавляет к событию index единицу
+func (c *CoalescingClient) AddEvent(clickID string, index uint8, opts ...sendClickOpt) error {
+	return c.SendEvent(clickID, binom.AddEvent(int8(index), 1), opts...)
+}
+
+// SubEvent вычитает у события index единицу
+func (c *CoalescingClient) SubEvent(clickID string, index uint8, opts ...sendClickOpt) error {
+	return c.SendEvent(clickID, binom.AddEvent(int8(index), -1), opts...)
+}
+
+// SetupEvent устанавливает событие index в единицу
+func (c *CoalescingClient) SetupEvent(clickID string, index uint8, opts ...sendClickOpt) error {
+	return c.SendEvent(clickID, binom.Event(int8(index), 1), opts...)
+}
+
+// ResetEvent устанавливает событие index в ноль
+func (c *CoalescingClient) ResetEvent(clickID string, index uint8, opts ...sendClickOpt) error {
+	return c.SendEvent(clickID, binom.Event(int8(index), 0), opts...)
+}
+
+// AddNamedEvent добавляет val к событию name, см. Client.AddNamedEvent
+func (c *CoalescingClient) AddNamedEvent(clickID string, name string, val int64, opts ...sendClickOpt) error {
+	ev, err := c.eventRegistry().AddEvent(name, val)
+	if err != nil {
+		return err
+	}
+
+	return c.SendEvent(clickID, ev, opts...)
+}
+
+// SetNamedEvent устанавливает событие name в val, см. Client.SetNamedEvent
+func (c *CoalescingClient) SetNamedEvent(clickID string, name string, val int64, opts ...sendClickOpt) error {
+	ev, err := c.eventRegistry().Event(name, val)
+	if err != nil {
+		return err
+	}
+
+	return c.SendEvent(clickID, ev, opts...)
+}
+
+func (c *CoalescingClient) eventRegistry() *EventRegistry {
+	return eventRegistryOf(c.Client)
+}
+
+// SendPostbackRequest отправляет postback вместе с накопленными событиями клика.
+// Если отправка не удалась, накопленные события возвращаются в буфер.
+// Если событий клика не накоплено, postback (в том числе запрос только с событиями)
+// отправляется в Client сразу, без накопления.
+func (c *CoalescingClient) SendPostbackRequest(postback Request, opts ...sendClickOpt) error {
+	buf := c.takeClick(postback.ClickID())
+	if buf == nil {
+		return c.Client.SendPostbackRequest(postback, opts...)
+	}
+	req, err := newRequestRecord(postback).request()
+	if err != nil {
+		c.restoreClick(postback.ClickID(), buf, err)
+		return err
+	}
+	req.events = buf.events
+	req.events.Merge(postback.Events())
+
+	err = c.Client.SendPostbackRequest(req, opts...)
+	if err != nil {
+		c.restoreClick(postback.ClickID(), buf, err)
+	}
+
+	return err
+}
+
+// SendPostback отправляет конверсию вместе с накопленными событиями клика.
+// Если отправка не удалась, накопленные события возвращаются в буфер.
+func (c *CoalescingClient) SendPostback(clickID string, status *string, payout *Money, events Events, opts ...sendClickOpt) error {
+	buf := c.takeClick(clickID)
+	if buf == nil {
+		return c.Client.SendPostback(clickID, status, payout, events, opts...)
+	}
+	merged := buf.events
+	merged.Merge(events)
+
+	err := c.Client.SendPostback(clickID, status, payout, merged, opts...)
+	if err != nil {
+		c.restoreClick(clickID, buf, err)
+	}
+
+	return err
+}
+
+// takeClick забирает из буфера накопленные события клика clickID, nil если их нет.
+func (c *CoalescingClient) takeClick(clickID string) *coalesceBuf {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	buf, ok := c.bufs[clickID]
+	if !ok {
+		return nil
+	}
+	buf.timer.Stop()
+	delete(c.bufs, clickID)
+
+	return buf
+}
+
+// restoreClick возвращает события buf в буфер клика clickID перед событиями,
+// накопленными за время отправки. После Close события с ошибкой отправки err
+// передаются в onError.
+func (c *CoalescingClient) restoreClick(clickID string, buf *coalesceBuf, err error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		c.report(clickID, buf.events, err)
+		return
+	}
+	defer c.mu.Unlock()
+
+	if cur, ok := c.bufs[clickID]; ok {
+		events := buf.events
+		events.Merge(cur.events)
+		cur.events = events
+		return
+	}
+	buf.timer = time.AfterFunc(c.window, func() {
+		c.flushClick(clickID)
+	})
+	c.bufs[clickID] = buf
+}
+
+// flushClick отправляет накопленные события клика clickID, если они есть.
+// После временной ошибки (IsRetryable) события возвращаются в буфер
+// и отправляются повторно по окончании следующего окна, о постоянной
+// ошибке сообщается через report.
+func (c *CoalescingClient) flushClick(clickID string) error {
+	buf := c.takeClick(clickID)
+	if buf == nil {
+		return nil
+	}
+
+	err := c.Client.SendEvents(clickID, buf.events, buf.opts...)
+	if err != nil {
+		if IsRetryable(err) {
+			c.restoreClick(clickID, buf, err)
+		} else {
+			c.report(clickID, buf.events, err)
+		}
+	}
+
+	return err
+}
+
+// report сообщает о неотправленных накопленных событиях клика.
+func (c *CoalescingClient) report(clickID string, events Events, err error) {
+	if c.log != nil {
+		c.log.Errorf("coalesced update for click %s failed: %v", clickID, err)
+	}
+	if c.onError != nil {
+		c.onError(clickID, events, err)
+	}
+}
+
+// Flush отправляет все накопленные обновления, не дожидаясь окончания окна.
+// Возвращает первую из ошибок отправки.
+func (c *CoalescingClient) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	clickIDs := make([]string, 0, len(c.bufs))
+	for clickID := range c.bufs {
+		clickIDs = append(clickIDs, clickID)
+	}
+	c.mu.Unlock()
+
+	var firstErr error
+	for _, clickID := range clickIDs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := c.flushClick(clickID); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Close отправляет накопленные обновления, после чего события
+// передаются в Client без накопления.
+func (c *CoalescingClient) Close(ctx context.Context) error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	return c.Flush(ctx)
+}
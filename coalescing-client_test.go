@@ -0,0 +1,222 @@
+package binomv2postback
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+// coalesceTracker запоминает запросы к трекеру и отвечает кодом status (по умолчанию 200)
+type coalesceTracker struct {
+	mu      sync.Mutex
+	queries []url.Values
+	status  int
+}
+
+func (tr *coalesceTracker) Send(req *TransportRequest) (*TransportResponse, error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.queries = append(tr.queries, req.URL.Query())
+	code := http.StatusOK
+	if tr.status != 0 {
+		code = tr.status
+	}
+
+	return &TransportResponse{StatusCode: code}, nil
+}
+
+func (tr *coalesceTracker) setStatus(code int) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.status = code
+}
+
+func (tr *coalesceTracker) sent() []url.Values {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return append([]url.Values(nil), tr.queries...)
+}
+
+func TestCoalescingClientMerge(t *testing.T) {
+	tr := &coalesceTracker{}
+	c := NewCoalescingClient(newDedupTestClient(t, tr), time.Hour)
+	c.AddEvent("c1", 1)
+	c.AddEvent("c1", 1)
+	c.SetupEvent("c1", 2)
+	c.SendEvent("c1", binom.AddEvent(2, 4))
+	c.ResetEvent("c2", 3)
+
+	if n := len(tr.sent()); n != 0 {
+		t.Fatalf("sent %d requests before the window ends", n)
+	}
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sent := tr.sent()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(sent))
+	}
+	for _, q := range sent {
+		switch q.Get("upd_clickid") {
+		case "c1":
+			if q.Get("add_event1") != "2" || q.Get("event2") != "5" || q.Has("add_event2") {
+				t.Errorf("c1 update = %v", q)
+			}
+		case "c2":
+			if q.Get("event3") != "0" {
+				t.Errorf("c2 update = %v", q)
+			}
+		default:
+			t.Errorf("unexpected update %v", q)
+		}
+	}
+}
+
+func TestCoalescingClientFlushOnTimer(t *testing.T) {
+	tr := &coalesceTracker{}
+	c := NewCoalescingClient(newDedupTestClient(t, tr), 10*time.Millisecond)
+	c.AddEvent("c1", 1)
+	c.AddEvent("c1", 1)
+
+	waitOutbox(t, func() bool { return len(tr.sent()) == 1 })
+	if q := tr.sent()[0]; q.Get("upd_clickid") != "c1" || q.Get("add_event1") != "2" {
+		t.Errorf("update = %v", q)
+	}
+}
+
+func TestCoalescingClientFlushOnConversion(t *testing.T) {
+	tr := &coalesceTracker{}
+	c := NewCoalescingClient(newDedupTestClient(t, tr), time.Hour)
+	c.AddEvent("c1", 1)
+	c.SetupEvent("c2", 2)
+
+	status := "approved"
+	if err := c.SendPostback("c1", &status, nil, Events{}); err != nil {
+		t.Fatal(err)
+	}
+	req := NewRequestBuilder().WithStatus(status).WithEvents(mustEvents(t, binom.AddEvent(2, 1))).Request("c2")
+	if err := c.SendPostbackRequest(req); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := tr.sent()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(sent))
+	}
+	if q := sent[0]; q.Get("cnv_id") != "c1" || q.Get("cnv_status") != "approved" || q.Get("add_event1") != "1" {
+		t.Errorf("c1 conversion = %v", q)
+	}
+	if q := sent[1]; q.Get("cnv_id") != "c2" || q.Get("event2") != "2" {
+		t.Errorf("c2 conversion = %v", q)
+	}
+	if err := c.Flush(context.Background()); err != nil || len(tr.sent()) != 2 {
+		t.Errorf("events left after the conversions: %v, %d requests", err, len(tr.sent()))
+	}
+}
+
+func TestCoalescingClientConversionFailureRestores(t *testing.T) {
+	tr := &coalesceTracker{status: http.StatusInternalServerError}
+	c := NewCoalescingClient(newDedupTestClient(t, tr), time.Hour)
+	c.AddEvent("c1", 1)
+
+	status := "approved"
+	if err := c.SendPostback("c1", &status, nil, Events{}); err == nil {
+		t.Fatal("failed conversion succeeded")
+	}
+	c.AddEvent("c1", 1)
+
+	tr.setStatus(http.StatusOK)
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sent := tr.sent()
+	if q := sent[len(sent)-1]; q.Get("upd_clickid") != "c1" || q.Get("add_event1") != "2" {
+		t.Errorf("update after failed conversion = %v", q)
+	}
+}
+
+func TestCoalescingClientTimerFailure(t *testing.T) {
+	tr := &coalesceTracker{status: http.StatusServiceUnavailable}
+	var mu sync.Mutex
+	var reported []Events
+	c := NewCoalescingClient(newDedupTestClient(t, tr), 10*time.Millisecond,
+		CoalesceWithErrorHandler(func(clickID string, events Events, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, events)
+		}))
+	c.AddEvent("c1", 1)
+
+	// временная ошибка: события возвращаются в буфер и уходят после следующего окна
+	waitOutbox(t, func() bool { return len(tr.sent()) >= 1 })
+	tr.setStatus(http.StatusOK)
+	failed := len(tr.sent())
+	waitOutbox(t, func() bool { return len(tr.sent()) > failed })
+	if q := tr.sent()[failed]; q.Get("upd_clickid") != "c1" || q.Get("add_event1") != "1" {
+		t.Errorf("update after retryable failure = %v", q)
+	}
+	mu.Lock()
+	if len(reported) != 0 {
+		t.Errorf("retryable failure reported: %v", reported)
+	}
+	mu.Unlock()
+
+	// постоянная ошибка: события отдаются обработчику
+	tr.setStatus(http.StatusBadRequest)
+	c.AddEvent("c2", 1)
+	waitOutbox(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reported) == 1
+	})
+	mu.Lock()
+	if ev, ok := reported[0].Get(1); !ok || ev.Value() != 1 {
+		t.Errorf("reported events = %v", reported[0])
+	}
+	mu.Unlock()
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCoalescingClientClose(t *testing.T) {
+	tr := &coalesceTracker{status: http.StatusInternalServerError}
+	var reported int
+	c := NewCoalescingClient(newDedupTestClient(t, tr), time.Hour,
+		CoalesceWithErrorHandler(func(clickID string, events Events, err error) {
+			reported++
+		}))
+	c.AddEvent("c1", 1)
+
+	// после Close неотправленные события не возвращаются в буфер
+	if err := c.Close(context.Background()); err == nil {
+		t.Fatal("Close with a failing tracker succeeded")
+	}
+	if reported != 1 {
+		t.Errorf("reported %d updates, want 1", reported)
+	}
+	tr.setStatus(http.StatusOK)
+	if err := c.AddEvent("c1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(tr.sent()); n != 2 {
+		t.Errorf("sent %d requests, want 2: events after Close are sent directly", n)
+	}
+}
+
+func mustEvents(t *testing.T, events ...Event) Events {
+	t.Helper()
+	e, err := NewEvents(events...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
@@ -0,0 +1,511 @@
+package binomv2postback
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config настройки клиента, которые можно загрузить из переменных окружения,
+// JSON или YAML файла. Ключи можно задать как значением, так и путем
+// к файлу (например Docker secret).
+type Config struct {
+	ClickURL         string                `json:"click_url" yaml:"click_url"`
+	APIKey           string                `json:"api_key" yaml:"api_key"`
+	APIKeyFile       string                `json:"api_key_file" yaml:"api_key_file"`
+	APIURL           string                `json:"api_url" yaml:"api_url"` // адрес Binom API, по умолчанию хост click_url
+	UPDKey           string                `json:"upd_key" yaml:"upd_key"`
+	UPDKeyFile       string                `json:"upd_key_file" yaml:"upd_key_file"`
+	Timeout          Duration              `json:"timeout" yaml:"timeout"`
+	Retry            *RetryConfig          `json:"retry" yaml:"retry"`
+	RateLimit        *RateLimitConfig      `json:"rate_limit" yaml:"rate_limit"`
+	Hosts            map[string]HostConfig `json:"hosts" yaml:"hosts"`
+	DryRun           bool                  `json:"dry_run" yaml:"dry_run"`
+	SendEmptyUpdates bool                  `json:"send_empty_updates" yaml:"send_empty_updates"`
+	UserAgent        string                `json:"user_agent" yaml:"user_agent"`
+	Events           map[string]int8       `json:"events" yaml:"events"`                     // имена событий, см. EventRegistry
+	Statuses         map[string][]string   `json:"statuses" yaml:"statuses"`                 // переходы статусов конверсии, см. StatusModel
+	BaseCurrency     string                `json:"base_currency" yaml:"base_currency"`       // валюта выплат трекера, см. PayoutNormalizer
+	RatesFile        string                `json:"rates_file" yaml:"rates_file"`             // курсы валют, см. LoadRatesFile
+	PayoutPrecision  *int                  `json:"payout_precision" yaml:"payout_precision"` // знаков после запятой в payout, см. WithPayoutPrecision
+}
+
+// RetryConfig настройки RetryPolicy
+type RetryConfig struct {
+	MaxAttempts          int      `json:"max_attempts" yaml:"max_attempts"`
+	BaseDelay            Duration `json:"base_delay" yaml:"base_delay"`
+	MaxDelay             Duration `json:"max_delay" yaml:"max_delay"`
+	Jitter               float64  `json:"jitter" yaml:"jitter"`
+	RetryableStatusCodes []int    `json:"retryable_status_codes" yaml:"retryable_status_codes"`
+	MaxRetryAfter        Duration `json:"max_retry_after" yaml:"max_retry_after"`
+}
+
+// RateLimitConfig настройки RateLimit
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `json:"requests_per_second" yaml:"requests_per_second"`
+	Burst             int     `json:"burst" yaml:"burst"`
+}
+
+// HostConfig настройки для отдельного хоста трекера (см. OptWithHost)
+type HostConfig struct {
+	Timeout   Duration         `json:"timeout" yaml:"timeout"`
+	RateLimit *RateLimitConfig `json:"rate_limit" yaml:"rate_limit"`
+}
+
+// Duration time.Duration, который читается из строки вида "1.5s" или "200ms".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+
+	return nil
+}
+
+// LoadConfigFromEnv читает настройки из переменных окружения (см. Config.ApplyEnv).
+func LoadConfigFromEnv() (Config, error) {
+	var cfg Config
+	err := cfg.ApplyEnv()
+
+	return cfg, err
+}
+
+// LoadConfigFile читает настройки из JSON (.json) или YAML (.yaml, .yml) файла.
+func LoadConfigFile(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return LoadConfigJSON(f)
+	case ".yaml", ".yml":
+		return LoadConfigYAML(f)
+	}
+
+	return Config{}, fmt.Errorf("unknown config format %q", filepath.Ext(path))
+}
+
+// LoadConfigJSON читает настройки в формате JSON.
+func LoadConfigJSON(r io.Reader) (Config, error) {
+	var cfg Config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("decode json config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// LoadConfigYAML читает настройки в формате YAML.
+func LoadConfigYAML(r io.Reader) (Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("decode yaml config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// ApplyEnv перекрывает настройки заданными переменными окружения.
+// Ключ из окружения заменяет ключ, заданный в настройках другим способом:
+// BINOM_API_KEY_FILE сбрасывает api_key, BINOM_API_KEY сбрасывает api_key_file
+// (так же для UPD ключа).
+//
+//	BINOM_CLICK_URL, BINOM_API_URL, BINOM_API_KEY, BINOM_API_KEY_FILE, BINOM_UPD_KEY, BINOM_UPD_KEY_FILE,
+//	BINOM_TIMEOUT, BINOM_DRY_RUN, BINOM_SEND_EMPTY_UPDATES, BINOM_USER_AGENT,
+//	BINOM_RETRY_MAX_ATTEMPTS, BINOM_RETRY_BASE_DELAY, BINOM_RETRY_MAX_DELAY, BINOM_RETRY_MAX_RETRY_AFTER, BINOM_RETRY_JITTER,
+//	BINOM_RATE_LIMIT, BINOM_RATE_BURST,
+//	BINOM_EVENTS (имена событий: "registration=1,deposit=2"),
+//	BINOM_BASE_CURRENCY, BINOM_RATES_FILE, BINOM_PAYOUT_PRECISION
+func (c *Config) ApplyEnv() error {
+	env := func(name string, set func(v string) error) error {
+		v, ok := os.LookupEnv(name)
+		if !ok || v == "" {
+			return nil
+		}
+		if err := set(v); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		return nil
+	}
+	str := func(dst *string) func(string) error {
+		return func(v string) error {
+			*dst = v
+			return nil
+		}
+	}
+	boolean := func(dst *bool) func(string) error {
+		return func(v string) (err error) {
+			*dst, err = strconv.ParseBool(v)
+			return err
+		}
+	}
+	retry := func() *RetryConfig {
+		if c.Retry == nil {
+			c.Retry = &RetryConfig{}
+		}
+		return c.Retry
+	}
+	rateLimit := func() *RateLimitConfig {
+		if c.RateLimit == nil {
+			c.RateLimit = &RateLimitConfig{}
+		}
+		return c.RateLimit
+	}
+
+	vars := []struct {
+		name string
+		set  func(v string) error
+	}{
+		{"BINOM_CLICK_URL", str(&c.ClickURL)},
+		{"BINOM_API_URL", str(&c.APIURL)},
+		{"BINOM_API_KEY", str(&c.APIKey)},
+		{"BINOM_API_KEY_FILE", str(&c.APIKeyFile)},
+		{"BINOM_UPD_KEY", str(&c.UPDKey)},
+		{"BINOM_UPD_KEY_FILE", str(&c.UPDKeyFile)},
+		{"BINOM_TIMEOUT", func(v string) error {
+			return c.Timeout.UnmarshalText([]byte(v))
+		}},
+		{"BINOM_DRY_RUN", boolean(&c.DryRun)},
+		{"BINOM_SEND_EMPTY_UPDATES", boolean(&c.SendEmptyUpdates)},
+		{"BINOM_USER_AGENT", str(&c.UserAgent)},
+		{"BINOM_RETRY_MAX_ATTEMPTS", func(v string) (err error) {
+			retry().MaxAttempts, err = strconv.Atoi(v)
+			return err
+		}},
+		{"BINOM_RETRY_BASE_DELAY", func(v string) error {
+			return retry().BaseDelay.UnmarshalText([]byte(v))
+		}},
+		{"BINOM_RETRY_MAX_DELAY", func(v string) error {
+			return retry().MaxDelay.UnmarshalText([]byte(v))
+		}},
+		{"BINOM_RETRY_MAX_RETRY_AFTER", func(v string) error {
+			return retry().MaxRetryAfter.UnmarshalText([]byte(v))
+		}},
+		{"BINOM_RETRY_JITTER", func(v string) (err error) {
+			retry().Jitter, err = strconv.ParseFloat(v, 64)
+			return err
+		}},
+		{"BINOM_RATE_LIMIT", func(v string) (err error) {
+			rateLimit().RequestsPerSecond, err = strconv.ParseFloat(v, 64)
+			return err
+		}},
+		{"BINOM_RATE_BURST", func(v string) (err error) {
+			rateLimit().Burst, err = strconv.Atoi(v)
+			return err
+		}},
+		{"BINOM_EVENTS", func(v string) error {
+			events, err := parseEventNames(v)
+			if err != nil {
+				return err
+			}
+			c.Events = events
+			return nil
+		}},
+		{"BINOM_BASE_CURRENCY", str(&c.BaseCurrency)},
+		{"BINOM_RATES_FILE", str(&c.RatesFile)},
+		{"BINOM_PAYOUT_PRECISION", func(v string) error {
+			digits, err := strconv.Atoi(v)
+			if err != nil {
+				return err
+			}
+			c.PayoutPrecision = &digits
+			return nil
+		}},
+	}
+	for _, v := range vars {
+		if err := env(v.name, v.set); err != nil {
+			return err
+		}
+	}
+	overrideSecret(&c.APIKey, &c.APIKeyFile, "BINOM_API_KEY", "BINOM_API_KEY_FILE")
+	overrideSecret(&c.UPDKey, &c.UPDKeyFile, "BINOM_UPD_KEY", "BINOM_UPD_KEY_FILE")
+
+	return nil
+}
+
+// overrideSecret сбрасывает способ задания ключа, перекрытый другим способом из окружения.
+// Если заданы обе переменные, конфликт сообщает Validate.
+func overrideSecret(value, file *string, valueEnv, fileEnv string) {
+	valueSet := os.Getenv(valueEnv) != ""
+	fileSet := os.Getenv(fileEnv) != ""
+	switch {
+	case valueSet && !fileSet:
+		*file = ""
+	case fileSet && !valueSet:
+		*value = ""
+	}
+}
+
+// Validate проверяет настройки, не читая файлы с ключами.
+func (c Config) Validate() error {
+	if err := validateClickBaseURL(c.ClickURL); err != nil {
+		return err
+	}
+	if c.APIURL != "" {
+		if err := validateClickBaseURL(c.APIURL); err != nil {
+			return fmt.Errorf("api_url: %w", err)
+		}
+	}
+	if c.APIKey != "" && c.APIKeyFile != "" {
+		return errors.New("both api_key and api_key_file are set")
+	}
+	if c.UPDKey != "" && c.UPDKeyFile != "" {
+		return errors.New("both upd_key and upd_key_file are set")
+	}
+	if c.Timeout < 0 {
+		return errors.New("negative timeout")
+	}
+	if r := c.Retry; r != nil {
+		if r.MaxAttempts < 0 {
+			return errors.New("negative retry max_attempts")
+		}
+		if r.BaseDelay < 0 || r.MaxDelay < 0 || r.MaxRetryAfter < 0 {
+			return errors.New("negative retry delay")
+		}
+		if r.MaxDelay > 0 && r.BaseDelay > r.MaxDelay {
+			return errors.New("retry base_delay is greater than max_delay")
+		}
+		if r.Jitter < 0 || r.Jitter > 1 {
+			return errors.New("retry jitter must be between 0 and 1")
+		}
+	}
+	if err := c.RateLimit.validate(); err != nil {
+		return err
+	}
+	if _, err := NewEventRegistry(c.Events); err != nil {
+		return err
+	}
+	if len(c.Statuses) > 0 {
+		if _, err := NewStatusModel(c.Statuses); err != nil {
+			return err
+		}
+	}
+	if c.BaseCurrency != "" {
+		if _, err := ParseCurrency(c.BaseCurrency); err != nil {
+			return fmt.Errorf("base_currency: %w", err)
+		}
+	}
+	if c.RatesFile != "" && c.BaseCurrency == "" {
+		return errors.New("rates_file is set without base_currency")
+	}
+	if p := c.PayoutPrecision; p != nil && (*p < 0 || *p > MaxMoneyScale) {
+		return fmt.Errorf("payout_precision must be between 0 and %d", MaxMoneyScale)
+	}
+	for host, hc := range c.Hosts {
+		if hc.Timeout < 0 {
+			return fmt.Errorf("host %s: negative timeout", host)
+		}
+		if err := hc.RateLimit.validate(); err != nil {
+			return fmt.Errorf("host %s: %w", host, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *RateLimitConfig) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.RequestsPerSecond <= 0 {
+		return errors.New("rate_limit requests_per_second must be positive")
+	}
+	if r.Burst < 0 {
+		return errors.New("negative rate_limit burst")
+	}
+
+	return nil
+}
+
+func (r *RateLimitConfig) rateLimit() RateLimit {
+	return RateLimit{RequestsPerSecond: r.RequestsPerSecond, Burst: r.Burst}
+}
+
+// RetryPolicy возвращает политику повторов. Без секции retry повторов нет,
+// коды ответов по умолчанию берутся из DefaultRetryPolicy.
+func (r *RetryConfig) RetryPolicy() RetryPolicy {
+	if r == nil {
+		return RetryPolicy{}
+	}
+	policy := RetryPolicy{
+		MaxAttempts:          r.MaxAttempts,
+		BaseDelay:            time.Duration(r.BaseDelay),
+		MaxDelay:             time.Duration(r.MaxDelay),
+		Jitter:               r.Jitter,
+		RetryableStatusCodes: r.RetryableStatusCodes,
+		MaxRetryAfter:        time.Duration(r.MaxRetryAfter),
+	}
+	if len(policy.RetryableStatusCodes) == 0 {
+		policy.RetryableStatusCodes = DefaultRetryPolicy().RetryableStatusCodes
+	}
+
+	return policy
+}
+
+// StatusModel возвращает модель статусов из секции statuses, nil если она не задана.
+func (c Config) StatusModel() (*StatusModel, error) {
+	if len(c.Statuses) == 0 {
+		return nil, nil
+	}
+
+	return NewStatusModel(c.Statuses)
+}
+
+// Options проверяет настройки, читает ключи из файлов
+// и возвращает соответствующие опции клиента.
+//
+// С секцией statuses последние статусы конверсий хранятся в памяти процесса
+// (NewMemoryStatusStore) и теряются при перезапуске. Другое хранилище задается
+// опцией после опций настроек:
+//
+//	model, err := cfg.StatusModel()
+//	cli, err := NewClientFromConfig(cfg, WithStatusModel(model, store))
+func (c Config) Options() ([]ClientOption, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	apiKey, err := readSecret(c.APIKey, c.APIKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read api key: %w", err)
+	}
+	updKey, err := readSecret(c.UPDKey, c.UPDKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read upd key: %w", err)
+	}
+
+	opts := []ClientOption{
+		WithClickBaseURL(c.ClickURL),
+		WithAPIKey(apiKey),
+		WithUPDKey(updKey),
+		WithTimeout(time.Duration(c.Timeout)),
+		WithDryRun(c.DryRun),
+		WithEmptyUpdates(c.SendEmptyUpdates),
+		WithRetryPolicy(c.Retry.RetryPolicy()),
+	}
+	if c.UserAgent != "" {
+		opts = append(opts, WithUserAgent(c.UserAgent))
+	}
+	if len(c.Events) > 0 {
+		registry, err := NewEventRegistry(c.Events)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithEventRegistry(registry))
+	}
+	model, err := c.StatusModel()
+	if err != nil {
+		return nil, err
+	}
+	if model != nil {
+		opts = append(opts, WithStatusModel(model, NewMemoryStatusStore()))
+	}
+	if c.RatesFile != "" {
+		rates, err := LoadRatesFile(c.RatesFile)
+		if err != nil {
+			return nil, err
+		}
+		base, _ := ParseCurrency(c.BaseCurrency)
+		normalizer, err := NewPayoutNormalizer(base, rates)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithPayoutNormalizer(normalizer))
+	}
+	if c.PayoutPrecision != nil {
+		opts = append(opts, WithPayoutPrecision(*c.PayoutPrecision))
+	}
+
+	var limiter *RateLimiter
+	if c.RateLimit != nil {
+		limiter = NewRateLimiter(c.RateLimit.rateLimit())
+	}
+	for host, hc := range c.Hosts {
+		if hc.Timeout > 0 {
+			opts = append(opts, WithHostTimeout(host, time.Duration(hc.Timeout)))
+		}
+		if hc.RateLimit != nil {
+			if limiter == nil {
+				// без общего лимита ограничены только перечисленные хосты
+				limiter = NewRateLimiter(RateLimit{})
+			}
+			limiter.SetHostLimit(host, hc.RateLimit.rateLimit())
+		}
+	}
+	if limiter != nil {
+		opts = append(opts, WithRateLimiter(limiter))
+	}
+
+	return opts, nil
+}
+
+// NewClientFromConfig создает клиент по настройкам cfg, opts применяются после них
+// и перекрывают их, см. Config.Options.
+func NewClientFromConfig(cfg Config, opts ...ClientOption) (Client, error) {
+	cfgOpts, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	return New(append(cfgOpts, opts...)...)
+}
+
+// parseEventNames разбирает список имен событий "registration=1,deposit=2".
+func parseEventNames(s string) (map[string]int8, error) {
+	events := make(map[string]int8)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("event %q: expected name=index", pair)
+		}
+		index, err := strconv.ParseInt(strings.TrimSpace(value), 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("event %q: %w", pair, err)
+		}
+		name = strings.TrimSpace(name)
+		if prev, ok := events[name]; ok && prev != int8(index) {
+			return nil, fmt.Errorf("%w: event %q is already event%d", ErrEventNameConflict, name, prev)
+		}
+		events[name] = int8(index)
+	}
+
+	return events, nil
+}
+
+// readSecret возвращает значение ключа или содержимое файла с ключом без пробелов по краям.
+func readSecret(value, path string) (string, error) {
+	if path == "" {
+		return value, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,316 @@
+package binomv2postback
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testConfigYAML = `
+click_url: https://binom.example/click.php
+api_key: secret
+upd_key_file: /run/secrets/upd
+timeout: 1.5s
+retry:
+  max_attempts: 3
+  base_delay: 200ms
+  max_delay: 2s
+rate_limit:
+  requests_per_second: 10
+  burst: 2
+hosts:
+  other.example:
+    timeout: 500ms
+events:
+  deposit: 2
+statuses:
+  lead: [approved]
+base_currency: usd
+payout_precision: 2
+`
+
+const testConfigJSON = `{
+	"click_url": "https://binom.example/click.php",
+	"api_key": "secret",
+	"upd_key_file": "/run/secrets/upd",
+	"timeout": "1.5s",
+	"retry": {"max_attempts": 3, "base_delay": "200ms", "max_delay": "2s"},
+	"rate_limit": {"requests_per_second": 10, "burst": 2},
+	"hosts": {"other.example": {"timeout": "500ms"}},
+	"events": {"deposit": 2},
+	"statuses": {"lead": ["approved"]},
+	"base_currency": "usd",
+	"payout_precision": 2
+}`
+
+func checkTestConfig(t *testing.T, name string, cfg Config) {
+	t.Helper()
+	if cfg.ClickURL != "https://binom.example/click.php" || cfg.APIKey != "secret" || cfg.UPDKeyFile != "/run/secrets/upd" {
+		t.Errorf("%s: keys = %+v", name, cfg)
+	}
+	if time.Duration(cfg.Timeout) != 1500*time.Millisecond {
+		t.Errorf("%s: timeout = %s", name, time.Duration(cfg.Timeout))
+	}
+	if r := cfg.Retry; r == nil || r.MaxAttempts != 3 || time.Duration(r.BaseDelay) != 200*time.Millisecond || time.Duration(r.MaxDelay) != 2*time.Second {
+		t.Errorf("%s: retry = %+v", name, r)
+	}
+	if r := cfg.RateLimit; r == nil || r.RequestsPerSecond != 10 || r.Burst != 2 {
+		t.Errorf("%s: rate_limit = %+v", name, r)
+	}
+	if time.Duration(cfg.Hosts["other.example"].Timeout) != 500*time.Millisecond {
+		t.Errorf("%s: hosts = %+v", name, cfg.Hosts)
+	}
+	if cfg.Events["deposit"] != 2 || len(cfg.Statuses["lead"]) != 1 || cfg.BaseCurrency != "usd" {
+		t.Errorf("%s: events %v, statuses %v, base_currency %q", name, cfg.Events, cfg.Statuses, cfg.BaseCurrency)
+	}
+	if cfg.PayoutPrecision == nil || *cfg.PayoutPrecision != 2 {
+		t.Errorf("%s: payout_precision = %v", name, cfg.PayoutPrecision)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("%s: %v", name, err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfigYAML(strings.NewReader(testConfigYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestConfig(t, "yaml", cfg)
+
+	cfg, err = LoadConfigJSON(strings.NewReader(testConfigJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestConfig(t, "json", cfg)
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{"binom.yml": testConfigYAML, "binom.yaml": testConfigYAML, "binom.json": testConfigJSON} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfigFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkTestConfig(t, name, cfg)
+	}
+	if _, err := LoadConfigFile(filepath.Join(dir, "binom.toml")); err == nil {
+		t.Error("missing file accepted")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "binom.toml"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfigFile(filepath.Join(dir, "binom.toml")); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	if _, err := LoadConfigYAML(strings.NewReader("click_url: x\nunknown: 1\n")); err == nil {
+		t.Error("yaml: unknown field accepted")
+	}
+	if _, err := LoadConfigJSON(strings.NewReader(`{"unknown": 1}`)); err == nil {
+		t.Error("json: unknown field accepted")
+	}
+	if _, err := LoadConfigYAML(strings.NewReader("timeout: 5\n")); err == nil {
+		t.Error("yaml: duration without unit accepted")
+	}
+	if _, err := LoadConfigJSON(strings.NewReader(`{"timeout": 5}`)); err == nil {
+		t.Error("json: numeric duration accepted")
+	}
+	if cfg, err := LoadConfigYAML(strings.NewReader("")); err != nil || cfg.ClickURL != "" {
+		t.Errorf("empty yaml = %+v, %v", cfg, err)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	for in, want := range map[string]time.Duration{"1.5s": 1500 * time.Millisecond, "200ms": 200 * time.Millisecond, "1h2m": time.Hour + 2*time.Minute, "0": 0} {
+		var d Duration
+		if err := d.UnmarshalText([]byte(in)); err != nil || time.Duration(d) != want {
+			t.Errorf("UnmarshalText(%q) = %s, %v, want %s", in, time.Duration(d), err, want)
+		}
+	}
+	for _, in := range []string{"", "5", "1.5", "fast"} {
+		var d Duration
+		if err := d.UnmarshalText([]byte(in)); err == nil {
+			t.Errorf("UnmarshalText(%q) = %s, want error", in, time.Duration(d))
+		}
+	}
+
+	d := Duration(90 * time.Second)
+	b, err := json.Marshal(d)
+	if err != nil || string(b) != `"1m30s"` {
+		t.Errorf("json.Marshal = %s, %v", b, err)
+	}
+	var back Duration
+	if err := json.Unmarshal(b, &back); err != nil || back != d {
+		t.Errorf("json round trip = %s, %v", time.Duration(back), err)
+	}
+	y, err := yaml.Marshal(struct {
+		D Duration `yaml:"d"`
+	}{d})
+	if err != nil || strings.TrimSpace(string(y)) != "d: 1m30s" {
+		t.Errorf("yaml.Marshal = %q, %v", y, err)
+	}
+}
+
+func TestConfigApplyEnv(t *testing.T) {
+	cfg, err := LoadConfigYAML(strings.NewReader(testConfigYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BINOM_CLICK_URL", "https://env.example/click.php")
+	t.Setenv("BINOM_TIMEOUT", "3s")
+	t.Setenv("BINOM_DRY_RUN", "true")
+	t.Setenv("BINOM_RETRY_MAX_ATTEMPTS", "5")
+	t.Setenv("BINOM_RATE_BURST", "7")
+	t.Setenv("BINOM_EVENTS", "registration=1, deposit=3")
+	t.Setenv("BINOM_PAYOUT_PRECISION", "4")
+	t.Setenv("BINOM_USER_AGENT", "")
+	if err := cfg.ApplyEnv(); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.ClickURL != "https://env.example/click.php" || time.Duration(cfg.Timeout) != 3*time.Second || !cfg.DryRun {
+		t.Errorf("overrides = %+v", cfg)
+	}
+	// переменные перекрывают только свои поля секции
+	if cfg.Retry.MaxAttempts != 5 || time.Duration(cfg.Retry.BaseDelay) != 200*time.Millisecond {
+		t.Errorf("retry = %+v", cfg.Retry)
+	}
+	if cfg.RateLimit.Burst != 7 || cfg.RateLimit.RequestsPerSecond != 10 {
+		t.Errorf("rate_limit = %+v", cfg.RateLimit)
+	}
+	if len(cfg.Events) != 2 || cfg.Events["deposit"] != 3 || cfg.Events["registration"] != 1 {
+		t.Errorf("events = %v", cfg.Events)
+	}
+	if *cfg.PayoutPrecision != 4 || cfg.APIKey != "secret" {
+		t.Errorf("payout_precision %d, api_key %q", *cfg.PayoutPrecision, cfg.APIKey)
+	}
+
+	for name, value := range map[string]string{
+		"BINOM_TIMEOUT":            "5",
+		"BINOM_DRY_RUN":            "maybe",
+		"BINOM_RETRY_MAX_ATTEMPTS": "x",
+		"BINOM_EVENTS":             "deposit",
+	} {
+		t.Setenv(name, value)
+		var cfg Config
+		if err := cfg.ApplyEnv(); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s=%s: %v", name, value, err)
+		}
+		t.Setenv(name, "")
+	}
+}
+
+func TestConfigEnvSecretOverride(t *testing.T) {
+	dir := t.TempDir()
+	apiKeyFile := filepath.Join(dir, "api_key")
+	if err := os.WriteFile(apiKeyFile, []byte(" from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// файл из окружения заменяет api_key из файла настроек
+	cfg := Config{ClickURL: "https://binom.example/click.php", APIKey: "from-config", UPDKeyFile: "/missing"}
+	t.Setenv("BINOM_API_KEY_FILE", apiKeyFile)
+	t.Setenv("BINOM_UPD_KEY", "upd-from-env")
+	if err := cfg.ApplyEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.APIKey != "" || cfg.APIKeyFile != apiKeyFile || cfg.UPDKey != "upd-from-env" || cfg.UPDKeyFile != "" {
+		t.Errorf("keys = %+v", cfg)
+	}
+	cli, err := NewClientFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := cli.(*client); c.apiKey != "from-file" || c.updKey == nil || *c.updKey != "upd-from-env" {
+		t.Errorf("client keys = %q, %v", c.apiKey, c.updKey)
+	}
+
+	// обе переменные одного ключа - конфликт
+	t.Setenv("BINOM_API_KEY", "from-env")
+	cfg = Config{ClickURL: "https://binom.example/click.php"}
+	if err := cfg.ApplyEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("both BINOM_API_KEY and BINOM_API_KEY_FILE accepted")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := func() Config {
+		return Config{ClickURL: "https://binom.example/click.php"}
+	}
+	neg := -1
+	tests := map[string]func(c *Config){
+		"no click url":        func(c *Config) { c.ClickURL = "" },
+		"both api keys":       func(c *Config) { c.APIKey, c.APIKeyFile = "a", "b" },
+		"negative timeout":    func(c *Config) { c.Timeout = -1 },
+		"base > max delay":    func(c *Config) { c.Retry = &RetryConfig{BaseDelay: 2, MaxDelay: 1} },
+		"jitter":              func(c *Config) { c.Retry = &RetryConfig{Jitter: 1.5} },
+		"rate":                func(c *Config) { c.RateLimit = &RateLimitConfig{} },
+		"event index":         func(c *Config) { c.Events = map[string]int8{"x": 31} },
+		"statuses":            func(c *Config) { c.Statuses = map[string][]string{"lead": {""}} },
+		"base currency":       func(c *Config) { c.BaseCurrency = "XXZ" },
+		"rates without base":  func(c *Config) { c.RatesFile = "rates.json" },
+		"payout precision":    func(c *Config) { c.PayoutPrecision = &neg },
+		"host rate limit":     func(c *Config) { c.Hosts = map[string]HostConfig{"h": {RateLimit: &RateLimitConfig{Burst: 1}}} },
+		"negative host delay": func(c *Config) { c.Hosts = map[string]HostConfig{"h": {Timeout: -1}} },
+	}
+	for name, f := range tests {
+		cfg := valid()
+		f(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+		if _, err := cfg.Options(); err == nil {
+			t.Errorf("%s: Options accepted", name)
+		}
+	}
+	if err := valid().Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConfigStatusStore(t *testing.T) {
+	cfg := Config{ClickURL: "https://binom.example/click.php", Statuses: map[string][]string{"lead": {"approved"}}}
+	cli, err := NewClientFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cli.(*client).statusStore.(*MemoryStatusStore); !ok {
+		t.Errorf("default status store = %T", cli.(*client).statusStore)
+	}
+
+	model, err := cfg.StatusModel()
+	if err != nil || model == nil {
+		t.Fatalf("StatusModel = %v, %v", model, err)
+	}
+	store := NewMemoryStatusStore()
+	cli, err = NewClientFromConfig(cfg, WithStatusModel(model, store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cli.(*client).statusStore; got != StatusStore(store) {
+		t.Error("status store from opts is not used")
+	}
+
+	if model, err := (Config{}).StatusModel(); model != nil || err != nil {
+		t.Errorf("StatusModel without statuses = %v, %v", model, err)
+	}
+	if _, err := (Config{Statuses: map[string][]string{"": nil}}).StatusModel(); err == nil {
+		t.Error("invalid statuses accepted")
+	}
+}
@@ -0,0 +1,249 @@
+package binomv2postback
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrUnknownStatus статуса конверсии нет в StatusModel
+	ErrUnknownStatus = errors.New("unknown conversion status")
+	// ErrIllegalStatusTransition StatusModel не разрешает переход между статусами
+	ErrIllegalStatusTransition = errors.New("illegal conversion status transition")
+)
+
+// StatusTransitionError статус конверсии нельзя сменить с From на To.
+// errors.Is(err, ErrIllegalStatusTransition) или ErrUnknownStatus для неизвестного To.
+type StatusTransitionError struct {
+	ClickID string
+	From    string   // последний известный статус, "" если неизвестен
+	To      string   // новый статус
+	Allowed []string // статусы, разрешенные после From
+	Err     error
+}
+
+func (e *StatusTransitionError) Error() string {
+	allowed := "none"
+	if len(e.Allowed) > 0 {
+		allowed = strings.Join(e.Allowed, ", ")
+	}
+	if errors.Is(e.Err, ErrUnknownStatus) {
+		return fmt.Sprintf("%v %q for click %s (known: %s)", e.Err, e.To, e.ClickID, allowed)
+	}
+
+	return fmt.Sprintf("%v for click %s: %q -> %q (allowed after %q: %s)", e.Err, e.ClickID, e.From, e.To, e.From, allowed)
+}
+
+func (e *StatusTransitionError) Unwrap() error {
+	return e.Err
+}
+
+// StatusModel статусы конверсии и разрешенные переходы между ними.
+// Первым может быть любой известный статус, повтор того же статуса
+// (например для обновления выплаты) разрешен всегда.
+type StatusModel struct {
+	transitions map[string]map[string]bool
+}
+
+// NewStatusModel создает модель из переходов статус -> разрешенные следующие статусы.
+// Статусы без исходящих переходов перечисляются с пустым списком или только как цели.
+//
+//	model, err := NewStatusModel(map[string][]string{
+//		"lead":     {"approved", "rejected"},
+//		"approved": {"rejected", "refunded"},
+//	})
+func NewStatusModel(transitions map[string][]string) (*StatusModel, error) {
+	m := &StatusModel{transitions: make(map[string]map[string]bool)}
+	for from, targets := range transitions {
+		if from == "" {
+			return nil, errors.New("empty conversion status")
+		}
+		if m.transitions[from] == nil {
+			m.transitions[from] = make(map[string]bool)
+		}
+		for _, to := range targets {
+			if to == "" {
+				return nil, fmt.Errorf("empty conversion status after %q", from)
+			}
+			m.transitions[from][to] = true
+			if m.transitions[to] == nil {
+				m.transitions[to] = make(map[string]bool)
+			}
+		}
+	}
+	if len(m.transitions) == 0 {
+		return nil, errors.New("empty conversion status model")
+	}
+
+	return m, nil
+}
+
+// DefaultStatusModel lead -> approved/rejected, approved -> rejected/refunded.
+// rejected и refunded конечные.
+func DefaultStatusModel() *StatusModel {
+	m, _ := NewStatusModel(map[string][]string{
+		"lead":     {"approved", "rejected"},
+		"approved": {"rejected", "refunded"},
+	})
+
+	return m
+}
+
+// Statuses возвращает известные статусы по алфавиту.
+func (m *StatusModel) Statuses() []string {
+	return sortedKeys(m.transitions)
+}
+
+// Allowed возвращает статусы, разрешенные после from. Для пустого from это все статусы.
+func (m *StatusModel) Allowed(from string) []string {
+	if from == "" {
+		return m.Statuses()
+	}
+
+	return sortedKeys(m.transitions[from])
+}
+
+// Validate проверяет смену статуса клика clickID с from (пустой - статус неизвестен) на to.
+func (m *StatusModel) Validate(clickID, from, to string) error {
+	if _, ok := m.transitions[to]; !ok {
+		return &StatusTransitionError{ClickID: clickID, From: from, To: to, Allowed: m.Statuses(), Err: ErrUnknownStatus}
+	}
+	if from == "" || from == to || m.transitions[from][to] {
+		return nil
+	}
+
+	return &StatusTransitionError{ClickID: clickID, From: from, To: to, Allowed: m.Allowed(from), Err: ErrIllegalStatusTransition}
+}
+
+// StatusStore хранит последний известный статус конверсии по клику.
+type StatusStore interface {
+	// Get возвращает статус клика, ok=false если статус неизвестен.
+	Get(clickID string) (status string, ok bool, err error)
+	Set(clickID string, status string) error
+}
+
+// MemoryStatusStore хранит статусы в памяти процесса.
+type MemoryStatusStore struct {
+	mu       sync.Mutex
+	statuses map[string]string
+}
+
+// NewMemoryStatusStore создает пустой MemoryStatusStore.
+func NewMemoryStatusStore() *MemoryStatusStore {
+	return &MemoryStatusStore{statuses: make(map[string]string)}
+}
+
+func (s *MemoryStatusStore) Get(clickID string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.statuses[clickID]
+
+	return status, ok, nil
+}
+
+func (s *MemoryStatusStore) Set(clickID string, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statuses[clickID] = status
+
+	return nil
+}
+
+// WithStatusModel проверяет статус каждой конверсии (cnv_status) по model
+// и последнему статусу клика из store. Недопустимый переход не отправляется
+// и возвращает StatusTransitionError, после отправки статус сохраняется в store
+// (в режиме dryRun не сохраняется).
+func WithStatusModel(model *StatusModel, store StatusStore) ClientOption {
+	return func(cli *client) error {
+		if model == nil {
+			return errors.New("nil status model")
+		}
+		if store == nil {
+			return errors.New("nil status store")
+		}
+		cli.statusModel = model
+		cli.statusStore = store
+		return nil
+	}
+}
+
+// clickLocks блокировки по clickID, не хранит блокировки свободных кликов.
+type clickLocks struct {
+	mu    sync.Mutex
+	locks map[string]*clickLock
+}
+
+type clickLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock блокирует клик clickID и возвращает функцию разблокировки.
+func (l *clickLocks) lock(clickID string) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*clickLock)
+	}
+	cl, ok := l.locks[clickID]
+	if !ok {
+		cl = &clickLock{}
+		l.locks[clickID] = cl
+	}
+	cl.refs++
+	l.mu.Unlock()
+
+	cl.mu.Lock()
+
+	return func() {
+		cl.mu.Unlock()
+		l.mu.Lock()
+		cl.refs--
+		if cl.refs == 0 {
+			delete(l.locks, clickID)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// statusInterceptor проверяет переход статуса конверсии и запоминает новый статус.
+// Проверка, отправка и сохранение статуса одного клика выполняются под блокировкой клика,
+// чтобы параллельные конверсии не прошли проверку по одному и тому же старому статусу.
+// Блокировка действует в пределах клиента: при общем StatusStore у нескольких
+// процессов порядок конверсий одного клика должен обеспечивать вызывающий.
+func (cli *client) statusInterceptor(next Sender) Sender {
+	return func(call *Call) error {
+		if cli.statusModel == nil || !call.IsConversion() {
+			return next(call)
+		}
+		status, ok := call.Param("cnv_status")
+		if !ok || status == "" {
+			return next(call)
+		}
+		defer cli.statusLocks.lock(call.ClickID)()
+
+		from, _, err := cli.statusStore.Get(call.ClickID)
+		if err != nil {
+			return fmt.Errorf("get conversion status of click %s: %w", call.ClickID, err)
+		}
+		if err := cli.statusModel.Validate(call.ClickID, from, status); err != nil {
+			return err
+		}
+
+		if err := next(call); err != nil {
+			return err
+		}
+		clkReq, err := cli.newClickReq(call.Options...)
+		if err != nil || clkReq.dryRun {
+			return err
+		}
+		if err := cli.statusStore.Set(call.ClickID, status); err != nil && cli.log != nil {
+			cli.log.Errorf("Failed to save conversion status of click %s: %v", call.ClickID, err)
+		}
+
+		return nil
+	}
+}
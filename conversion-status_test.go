@@ -0,0 +1,200 @@
+package binomv2postback
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewStatusModel(t *testing.T) {
+	for name, transitions := range map[string]map[string][]string{
+		"empty":       {},
+		"empty from":  {"": {"approved"}},
+		"empty to":    {"lead": {""}},
+		"nil targets": nil,
+	} {
+		if _, err := NewStatusModel(transitions); err == nil {
+			t.Errorf("%s: model accepted", name)
+		}
+	}
+
+	m, err := NewStatusModel(map[string][]string{"lead": {"approved"}, "hold": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(m.Statuses(), ","); got != "approved,hold,lead" {
+		t.Errorf("Statuses = %s", got)
+	}
+}
+
+func TestStatusModelValidate(t *testing.T) {
+	m := DefaultStatusModel()
+	tests := []struct {
+		from, to string
+		want     error
+	}{
+		{"", "lead", nil},
+		{"", "refunded", nil},
+		{"lead", "approved", nil},
+		{"lead", "rejected", nil},
+		{"approved", "refunded", nil},
+		{"approved", "approved", nil},
+		{"rejected", "rejected", nil},
+		{"lead", "refunded", ErrIllegalStatusTransition},
+		{"approved", "lead", ErrIllegalStatusTransition},
+		{"rejected", "approved", ErrIllegalStatusTransition},
+		{"refunded", "approved", ErrIllegalStatusTransition},
+		{"lead", "paid", ErrUnknownStatus},
+		{"", "paid", ErrUnknownStatus},
+	}
+	for _, tt := range tests {
+		err := m.Validate("c1", tt.from, tt.to)
+		if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+			t.Errorf("Validate(%q -> %q) = %v, want %v", tt.from, tt.to, err, tt.want)
+			continue
+		}
+		var transitionErr *StatusTransitionError
+		if err != nil && (!errors.As(err, &transitionErr) || transitionErr.ClickID != "c1" || !strings.Contains(err.Error(), "c1")) {
+			t.Errorf("Validate(%q -> %q) error does not name the click: %v", tt.from, tt.to, err)
+		}
+	}
+
+	if got := strings.Join(m.Allowed("approved"), ","); got != "refunded,rejected" {
+		t.Errorf("Allowed(approved) = %s", got)
+	}
+	if got := m.Allowed("rejected"); len(got) != 0 {
+		t.Errorf("Allowed(rejected) = %v", got)
+	}
+	if got := strings.Join(m.Allowed(""), ","); got != strings.Join(m.Statuses(), ",") {
+		t.Errorf("Allowed(\"\") = %s", got)
+	}
+}
+
+func TestRequestBuilderStatusModel(t *testing.T) {
+	builder := NewRequestBuilder().WithStatus("lead").WithStatusModel(DefaultStatusModel(), "approved")
+
+	req, err := builder.Build("c1")
+	var transitionErr *StatusTransitionError
+	if req != nil || !errors.As(err, &transitionErr) || transitionErr.ClickID != "c1" {
+		t.Fatalf("Build = %v, %v, want transition error for c1", req, err)
+	}
+	if err := NewRequestBuilderWithClickID("c2").WithStatus("lead").WithStatusModel(DefaultStatusModel(), "approved").Err(); !errors.As(err, &transitionErr) || transitionErr.ClickID != "c2" {
+		t.Errorf("Err = %v, want transition error for c2", err)
+	}
+
+	req, err = builder.WithStatus("refunded").Build("c1")
+	if err != nil || req.ClickID() != "c1" || req.ConversionStatus() != "refunded" {
+		t.Errorf("Build = %v, %v", req, err)
+	}
+	if _, err := NewRequestBuilder().WithCurrency("XXZ").Build("c1"); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("Build with unknown currency: %v", err)
+	}
+}
+
+func TestClientStatusModel(t *testing.T) {
+	var fail atomic.Bool
+	store := NewMemoryStatusStore()
+	cli := newDedupTestClient(t, TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		if fail.Load() {
+			return &TransportResponse{StatusCode: http.StatusInternalServerError}, nil
+		}
+		return &TransportResponse{StatusCode: http.StatusOK}, nil
+	}), WithStatusModel(DefaultStatusModel(), store))
+	send := func(status string, opts ...sendClickOpt) error {
+		return cli.SendPostback("c1", &status, nil, Events{}, opts...)
+	}
+
+	if err := send("lead"); err != nil {
+		t.Fatal(err)
+	}
+	// dry-run и неудачная отправка статус не меняют
+	if err := send("approved", OptDryRun()); err != nil {
+		t.Fatal(err)
+	}
+	fail.Store(true)
+	if err := send("approved"); err == nil {
+		t.Fatal("failed send succeeded")
+	}
+	fail.Store(false)
+	if status, _, _ := store.Get("c1"); status != "lead" {
+		t.Fatalf("status = %q, want lead", status)
+	}
+
+	if err := send("approved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := send("lead"); !errors.Is(err, ErrIllegalStatusTransition) {
+		t.Errorf("approved -> lead: %v", err)
+	}
+	if err := send("paid"); !errors.Is(err, ErrUnknownStatus) {
+		t.Errorf("unknown status: %v", err)
+	}
+	// события без статуса модель не проверяет
+	if err := cli.SendEvents("c1", Events{}); err != nil && !errors.Is(err, ErrEmptyUpdate) {
+		t.Errorf("events: %v", err)
+	}
+}
+
+func TestClientStatusModelSerializesClick(t *testing.T) {
+	model, err := NewStatusModel(map[string][]string{"lead": {"approved", "rejected"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inflight, maxInflight atomic.Int32
+	cli := newDedupTestClient(t, TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			m := maxInflight.Load()
+			if n <= m || maxInflight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return &TransportResponse{StatusCode: http.StatusOK}, nil
+	}), WithStatusModel(model, NewMemoryStatusStore()))
+
+	// approved и rejected конечные: после одного второй переход недопустим
+	status := "lead"
+	if err := cli.SendPostback("c1", &status, nil, Events{}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, status := range []string{"approved", "rejected"} {
+		wg.Add(1)
+		go func(i int, status string) {
+			defer wg.Done()
+			errs[i] = cli.SendPostback("c1", &status, nil, Events{})
+		}(i, status)
+	}
+	wg.Wait()
+
+	var sent, rejected int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			sent++
+		case errors.Is(err, ErrIllegalStatusTransition):
+			rejected++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if sent != 1 || rejected != 1 {
+		t.Errorf("sent %d, rejected %d, want one of each", sent, rejected)
+	}
+	if n := maxInflight.Load(); n != 1 {
+		t.Errorf("%d conversions of one click sent in parallel", n)
+	}
+	c := cli.(*client)
+	c.statusLocks.mu.Lock()
+	defer c.statusLocks.mu.Unlock()
+	if n := len(c.statusLocks.locks); n != 0 {
+		t.Errorf("%d click locks left", n)
+	}
+}
@@ -0,0 +1,238 @@
+package binomv2postback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnknownCurrency код валюты не входит в ISO 4217
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// ErrNoRate у RatesProvider нет курса для пары валют
+var ErrNoRate = errors.New("no exchange rate")
+
+// Currency код валюты ISO 4217: USD, EUR, RUB.
+type Currency string
+
+// ParseCurrency проверяет код валюты по ISO 4217, регистр не важен.
+func ParseCurrency(s string) (Currency, error) {
+	c := Currency(strings.ToUpper(strings.TrimSpace(s)))
+	if !c.Valid() {
+		return "", fmt.Errorf("%w: %q", ErrUnknownCurrency, s)
+	}
+
+	return c, nil
+}
+
+// Valid сообщает, входит ли код в ISO 4217.
+func (c Currency) Valid() bool {
+	_, ok := iso4217[string(c)]
+	return ok
+}
+
+func (c Currency) String() string {
+	return string(c)
+}
+
+func (c *Currency) UnmarshalText(text []byte) error {
+	parsed, err := ParseCurrency(string(text))
+	if err != nil {
+		return err
+	}
+	*c = parsed
+
+	return nil
+}
+
+// iso4217 действующие коды валют ISO 4217
+var iso4217 = func() map[string]struct{} {
+	codes := strings.Fields(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND BOB BOV
+		BRL BSD BTN BWP BYN BZD CAD CDF CHE CHF CHW CLF CLP CNY COP COU CRC CUC CUP CVE
+		CZK DJF DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GNF GTQ GYD HKD
+		HNL HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW KWD KYD
+		KZT LAK LBP LKR LRD LSL LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MXV
+		MYR MZN NAD NGN NIO NOK NPR NZD OMR PAB PEN PGK PHP PKR PLN PYG QAR RON RSD RUB
+		RWF SAR SBD SCR SDG SEK SGD SHP SLE SLL SOS SRD SSP STN SVC SYP SZL THB TJS TMT
+		TND TOP TRY TTD TWD TZS UAH UGX USD USN UYI UYU UYW UZS VED VES VND VUV WST XAF
+		XAG XAU XBA XBB XBC XBD XCD XCG XDR XOF XPD XPF XPT XSU XTS XUA XXX YER ZAR ZMW
+		ZWG ZWL`)
+	m := make(map[string]struct{}, len(codes))
+	for _, code := range codes {
+		m[code] = struct{}{}
+	}
+
+	return m
+}()
+
+// RatesProvider курсы валют для PayoutNormalizer.
+type RatesProvider interface {
+	// Rate возвращает, сколько единиц to стоит одна единица from.
+	Rate(ctx context.Context, from, to Currency) (float64, error)
+}
+
+// StaticRates фиксированные курсы к базовой валюте, например загруженные из файла.
+type StaticRates struct {
+	base  Currency
+	rates map[Currency]float64 // сколько base стоит одна единица валюты
+}
+
+// NewStaticRates создает курсы: rates[c] - сколько base стоит одна единица c.
+func NewStaticRates(base Currency, rates map[Currency]float64) (*StaticRates, error) {
+	if !base.Valid() {
+		return nil, fmt.Errorf("base currency: %w: %q", ErrUnknownCurrency, base)
+	}
+	s := &StaticRates{base: base, rates: map[Currency]float64{base: 1}}
+	for c, rate := range rates {
+		if !c.Valid() {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownCurrency, c)
+		}
+		if rate <= 0 {
+			return nil, fmt.Errorf("rate of %s must be positive", c)
+		}
+		s.rates[c] = rate
+	}
+
+	return s, nil
+}
+
+// ratesFile формат файла курсов:
+//
+//	{"base": "USD", "rates": {"EUR": 1.08, "RUB": 0.011}}
+type ratesFile struct {
+	Base  Currency             `json:"base" yaml:"base"`
+	Rates map[Currency]float64 `json:"rates" yaml:"rates"`
+}
+
+// LoadRatesFile читает курсы из JSON или YAML файла (по расширению .yaml/.yml).
+func LoadRatesFile(path string) (*StaticRates, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rf ratesFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.NewDecoder(f).Decode(&rf)
+	default:
+		err = json.NewDecoder(f).Decode(&rf)
+	}
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("rates file %s: %w", path, err)
+	}
+
+	rates, err := NewStaticRates(rf.Base, rf.Rates)
+	if err != nil {
+		return nil, fmt.Errorf("rates file %s: %w", path, err)
+	}
+
+	return rates, nil
+}
+
+func (s *StaticRates) Rate(_ context.Context, from, to Currency) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	fromRate, ok := s.rates[from]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s -> %s", ErrNoRate, from, to)
+	}
+	toRate, ok := s.rates[to]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s -> %s", ErrNoRate, from, to)
+	}
+
+	return fromRate / toRate, nil
+}
+
+// PayoutNormalizer переводит выплаты в базовую валюту трекера.
+type PayoutNormalizer struct {
+	base  Currency
+	rates RatesProvider
+}
+
+// NewPayoutNormalizer создает PayoutNormalizer в валюту base с курсами rates.
+func NewPayoutNormalizer(base Currency, rates RatesProvider) (*PayoutNormalizer, error) {
+	if !base.Valid() {
+		return nil, fmt.Errorf("base currency: %w: %q", ErrUnknownCurrency, base)
+	}
+	if rates == nil {
+		return nil, errors.New("nil rates provider")
+	}
+
+	return &PayoutNormalizer{base: base, rates: rates}, nil
+}
+
+// Base возвращает базовую валюту.
+func (n *PayoutNormalizer) Base() Currency {
+	return n.base
+}
+
+// Convert переводит amount в базовую валюту. Результат округляется до MaxMoneyScale знаков.
+func (n *PayoutNormalizer) Convert(ctx context.Context, amount Money) (Money, error) {
+	if amount.Currency() == n.base {
+		return amount, nil
+	}
+	rate, err := n.rates.Rate(ctx, amount.Currency(), n.base)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return amount.mul(rate, n.base)
+}
+
+// NormalizeRequest возвращает копию req с выплатой в базовой валюте.
+// Исходные выплата и валюта сохраняются в OriginalPayout и OriginalCurrency.
+// Запрос без выплаты или валюты, или уже в базовой валюте возвращается как есть.
+func (n *PayoutNormalizer) NormalizeRequest(ctx context.Context, req Request) (Request, error) {
+	payout, ok := payoutMoney(req)
+	if !ok || req.Currency() == "" {
+		return req, nil
+	}
+	currency, err := ParseCurrency(req.Currency())
+	if err != nil {
+		return nil, err
+	}
+	if currency == n.base {
+		return req, nil
+	}
+	converted, err := n.Convert(ctx, payout.WithCurrency(currency))
+	if err != nil {
+		return nil, err
+	}
+
+	rec, err := newRequestRecord(req).request()
+	if err != nil {
+		return nil, err
+	}
+	original, originalCurrency := payout.WithCurrency(""), string(currency)
+	converted, base := converted.WithCurrency(""), string(n.base)
+	rec.originalPayout = &original
+	rec.originalCurrency = &originalCurrency
+	rec.payout = &converted
+	rec.currency = &base
+
+	return rec, nil
+}
+
+// WithPayoutNormalizer переводит выплату SendPostbackRequest и SendPostback в базовую
+// валюту normalizer перед отправкой (cnv_currency становится базовой валютой).
+func WithPayoutNormalizer(normalizer *PayoutNormalizer) ClientOption {
+	return func(cli *client) error {
+		if normalizer == nil {
+			return errors.New("nil payout normalizer")
+		}
+		cli.normalizer = normalizer
+		return nil
+	}
+}
@@ -0,0 +1,176 @@
+package binomv2postback
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCurrency(t *testing.T) {
+	for in, want := range map[string]Currency{"USD": "USD", "eur": "EUR", " rub ": "RUB", "XXX": "XXX"} {
+		if got, err := ParseCurrency(in); err != nil || got != want {
+			t.Errorf("ParseCurrency(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "US", "USDT", "XXZ", "RUR", "12$"} {
+		if _, err := ParseCurrency(in); !errors.Is(err, ErrUnknownCurrency) {
+			t.Errorf("ParseCurrency(%q): %v", in, err)
+		}
+	}
+	var c Currency
+	if err := c.UnmarshalText([]byte("gbp")); err != nil || c != "GBP" {
+		t.Errorf("UnmarshalText = %q, %v", c, err)
+	}
+}
+
+func TestStaticRates(t *testing.T) {
+	rates, err := NewStaticRates("USD", map[Currency]float64{"EUR": 1.1, "RUB": 0.01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, tt := range []struct {
+		from, to Currency
+		want     float64
+	}{
+		{"EUR", "USD", 1.1},
+		{"USD", "RUB", 100},
+		{"EUR", "RUB", 110},
+		{"USD", "USD", 1},
+	} {
+		if got, err := rates.Rate(ctx, tt.from, tt.to); err != nil || got < tt.want*0.999999 || got > tt.want*1.000001 {
+			t.Errorf("Rate(%s, %s) = %v, %v, want %v", tt.from, tt.to, got, err, tt.want)
+		}
+	}
+	if _, err := rates.Rate(ctx, "GBP", "USD"); !errors.Is(err, ErrNoRate) {
+		t.Errorf("unknown rate: %v", err)
+	}
+
+	if _, err := NewStaticRates("XXZ", nil); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("invalid base: %v", err)
+	}
+	if _, err := NewStaticRates("USD", map[Currency]float64{"EUR": 0}); err == nil {
+		t.Error("zero rate accepted")
+	}
+}
+
+func TestLoadRatesFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"rates.json": `{"base": "usd", "rates": {"EUR": 2}}`,
+		"rates.yaml": "base: USD\nrates:\n  eur: 2\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		rates, err := LoadRatesFile(path)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got, err := rates.Rate(context.Background(), "EUR", "USD"); err != nil || got != 2 {
+			t.Errorf("%s: Rate = %v, %v", name, got, err)
+		}
+	}
+}
+
+func TestPayoutNormalizer(t *testing.T) {
+	rates, _ := NewStaticRates("USD", map[Currency]float64{"EUR": 1.1})
+	n, err := NewPayoutNormalizer("USD", rates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	eur, _ := ParseMoney("10", "EUR")
+	if got, err := n.Convert(ctx, eur); err != nil || got.String() != "11" || got.Currency() != "USD" {
+		t.Errorf("Convert = %s %s, %v", got, got.Currency(), err)
+	}
+	gbp, _ := ParseMoney("10", "GBP")
+	if _, err := n.Convert(ctx, gbp); !errors.Is(err, ErrNoRate) {
+		t.Errorf("Convert without rate: %v", err)
+	}
+
+	req, err := n.NormalizeRequest(ctx, NewRequestBuilder().WithPayoutMoney(eur).Request("c1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := req.(MoneyRequest)
+	if req.Payout() != "11" || req.Currency() != "USD" || mr.OriginalPayout() != "10" || mr.OriginalCurrency() != "EUR" {
+		t.Errorf("normalized request = %s, original %s %s", req.URLParam(), mr.OriginalPayout(), mr.OriginalCurrency())
+	}
+
+	// Request без MoneyRequest: выплата разбирается из Payout и Currency
+	req, err = n.NormalizeRequest(ctx, plainRequest{NewRequestBuilder().WithPayout(10).WithCurrency("eur").Request("c1")})
+	if err != nil || req.Payout() != "11" || req.Currency() != "USD" {
+		t.Errorf("normalized plain request = %v, %v", req, err)
+	}
+
+	usd := NewRequestBuilder().WithPayoutMoney(eur.WithCurrency("USD")).Request("c1")
+	if req, err := n.NormalizeRequest(ctx, usd); err != nil || req != usd {
+		t.Errorf("request in base currency changed: %v, %v", req, err)
+	}
+}
+
+// plainRequest скрывает MoneyRequest у обернутого Request
+type plainRequest struct {
+	Request
+}
+
+func TestClientPayoutNormalization(t *testing.T) {
+	var query url.Values
+	rates, _ := NewStaticRates("USD", map[Currency]float64{"EUR": 1.5})
+	n, _ := NewPayoutNormalizer("USD", rates)
+	cli := newDedupTestClient(t, TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		query = req.URL.Query()
+		return &TransportResponse{StatusCode: http.StatusOK}, nil
+	}), WithPayoutNormalizer(n))
+
+	status := "approved"
+	payout, _ := ParseMoney("2", "EUR")
+	if err := cli.SendPostback("c1", &status, &payout, Events{}); err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("payout") != "3" || query.Get("cnv_currency") != "USD" {
+		t.Errorf("SendPostback query = %v", query)
+	}
+
+	if err := cli.SendPostbackRequest(NewRequestBuilder().WithPayoutMoney(payout).Request("c2")); err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("cnv_id") != "c2" || query.Get("payout") != "3" || query.Get("cnv_currency") != "USD" {
+		t.Errorf("SendPostbackRequest query = %v", query)
+	}
+}
+
+func TestClientRejectsUnknownCurrency(t *testing.T) {
+	var sent int
+	cli := newDedupTestClient(t, TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		sent++
+		return &TransportResponse{StatusCode: http.StatusOK}, nil
+	}))
+
+	req := NewRequestBuilder().WithPayout(1).WithCurrency("XXZ").Request("c1")
+	var paramErr *ParamError
+	if err := cli.SendPostbackRequest(req); !errors.As(err, &paramErr) || paramErr.Param != "cnv_currency" || !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("SendPostbackRequest: %v", err)
+	}
+	payout, _ := ParseMoney("1", "")
+	payout = payout.WithCurrency("XXZ")
+	if err := cli.SendPostback("c1", nil, &payout, Events{}); !errors.Is(err, ErrUnknownCurrency) {
+		t.Errorf("SendPostback: %v", err)
+	}
+	if sent != 0 {
+		t.Errorf("sent %d requests with an unknown currency", sent)
+	}
+
+	if err := cli.SendPostbackRequest(NewRequestBuilder().WithPayout(1).WithCurrency("usd").Request("c1")); err != nil || sent != 1 {
+		t.Errorf("valid currency: %v", err)
+	}
+}
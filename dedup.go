@@ -0,0 +1,436 @@
+package binomv2postback
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDuplicate postback уже был отправлен в пределах окна дедупликации и подавлен
+var ErrDuplicate = errors.New("duplicate postback suppressed")
+
+// DedupStore хранит ключи отправленных postback запросов.
+type DedupStore interface {
+	// Add отмечает ключ на ttl. Возвращает false, если ключ уже есть и не истек.
+	Add(key string, ttl time.Duration) (bool, error)
+	// Remove удаляет ключ, например если отправка не удалась.
+	Remove(key string) error
+}
+
+// OptWithIdempotencyKey добавляет к ключу дедупликации ключ вызывающей стороны,
+// например ID postback запроса партнерской сети.
+func OptWithIdempotencyKey(key string) sendClickOpt {
+	return func(cli *client, clkReq *clickReq) error {
+		clkReq.idempotencyKey = key
+		return nil
+	}
+}
+
+// DedupClient подавляет повторные postback запросы с теми же clickID,
+// статусами, выплатой, событиями и ключом OptWithIdempotencyKey в пределах ttl.
+// Для подавленного запроса возвращается ErrDuplicate.
+//
+// Повтор, пришедший пока первый запрос еще отправляется, ждет его результата:
+// если первый запрос не доставлен, повтор отправляется сам, а не теряется.
+// Ожидание прерывается контекстом OptWithContext повтора.
+type DedupClient struct {
+	Client
+	store DedupStore
+	ttl   time.Duration
+	log   Logger
+
+	mu       sync.Mutex
+	inflight map[string]*dedupFlight
+}
+
+// dedupFlight отправка запроса, которую ждут повторы
+type dedupFlight struct {
+	done chan struct{}
+	err  error
+}
+
+// NewDedupClient создает DedupClient поверх cli.
+func NewDedupClient(cli Client, store DedupStore, ttl time.Duration) *DedupClient {
+	return &DedupClient{Client: cli, store: store, ttl: ttl, inflight: make(map[string]*dedupFlight)}
+}
+
+func (d *DedupClient) eventRegistry() *EventRegistry {
+	return eventRegistryOf(d.Client)
+}
+
+// SetLogger задает логгер для решений о дубликатах и передает его в Client.
+func (d *DedupClient) SetLogger(log Logger) {
+	d.log = log
+	d.Client.SetLogger(log)
+}
+
+// SendPostbackRequest отправляет postback, если он не дубликат.
+func (d *DedupClient) SendPostbackRequest(postback Request, opts ...sendClickOpt) error {
+	key := dedupKey(idempotencyKey(opts), postback.ClickID(), postback.ConversionStatus(), postback.ConversionStatus2(),
+		postback.Payout(), postback.Currency(), postback.Events())
+
+	return d.send(callContext(opts), key, postback.ClickID(), func() error {
+		return d.Client.SendPostbackRequest(postback, opts...)
+	})
+}
+
+// SendPostback отправляет конверсию, если она не дубликат.
+func (d *DedupClient) SendPostback(clickID string, status *string, payout *Money, events Events, opts ...sendClickOpt) error {
+	var st, po, cur string
+	if status != nil {
+		st = *status
+	}
+	if payout != nil {
+		po, cur = payout.String(), string(payout.Currency())
+	}
+	key := dedupKey(idempotencyKey(opts), clickID, st, "", po, cur, events)
+
+	return d.send(callContext(opts), key, clickID, func() error {
+		return d.Client.SendPostback(clickID, status, payout, events, opts...)
+	})
+}
+
+func (d *DedupClient) send(ctx context.Context, key, clickID string, send func() error) error {
+	for {
+		d.mu.Lock()
+		if flight, ok := d.inflight[key]; ok {
+			d.mu.Unlock()
+			select {
+			case <-flight.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if flight.err == nil {
+				d.duplicate(clickID)
+				return ErrDuplicate
+			}
+			// первый запрос не доставлен, отправляем повтор
+			continue
+		}
+
+		added, err := d.store.Add(key, d.ttl)
+		if err != nil {
+			d.mu.Unlock()
+			return err
+		}
+		if !added {
+			d.mu.Unlock()
+			d.duplicate(clickID)
+			return ErrDuplicate
+		}
+		flight := &dedupFlight{done: make(chan struct{})}
+		d.inflight[key] = flight
+		d.mu.Unlock()
+
+		flight.err = send()
+		if flight.err != nil {
+			// не доставленный запрос можно повторить
+			if rerr := d.store.Remove(key); rerr != nil && d.log != nil {
+				d.log.Errorf("Failed to remove dedup key for click %s: %v", clickID, rerr)
+			}
+		}
+		d.mu.Lock()
+		delete(d.inflight, key)
+		d.mu.Unlock()
+		close(flight.done)
+
+		return flight.err
+	}
+}
+
+func (d *DedupClient) duplicate(clickID string) {
+	if d.log != nil {
+		d.log.Infof("Duplicate postback for click %s suppressed", clickID)
+	}
+}
+
+// idempotencyKey достает из опций ключ OptWithIdempotencyKey.
+func idempotencyKey(opts []sendClickOpt) string {
+	clkReq := &clickReq{}
+	for _, f := range opts {
+		// ошибки опций проявятся при отправке
+		_ = f(nil, clkReq)
+	}
+
+	return clkReq.idempotencyKey
+}
+
+func dedupKey(idempotencyKey, clickID, status, status2, payout, currency string, events Events) string {
+	h := sha256.New()
+	for _, part := range []string{idempotencyKey, clickID, status, status2, payout, currency, events.URLParams()} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type memoryDedupEntry struct {
+	key     string
+	expires time.Time
+}
+
+// MemoryDedupStore хранит ключи в памяти, вытесняя самые старые сверх capacity.
+// Истекшие ключи удаляются при Add: с конца списка сразу, а остальные
+// при полном проходе, когда число добавлений с прошлого прохода достигает
+// числа ключей (но не меньше dedupCompactMin).
+type MemoryDedupStore struct {
+	capacity int
+
+	mu    sync.Mutex
+	order *list.List
+	keys  map[string]*list.Element
+	adds  int // добавлений с прошлого полного прохода
+}
+
+// NewMemoryDedupStore создает LRU хранилище на capacity ключей (0 - без ограничения).
+func NewMemoryDedupStore(capacity int) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		capacity: capacity,
+		order:    list.New(),
+		keys:     make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryDedupStore) Add(key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if el, ok := s.keys[key]; ok {
+		entry := el.Value.(*memoryDedupEntry)
+		if now.Before(entry.expires) {
+			s.order.MoveToFront(el)
+			return false, nil
+		}
+		s.order.Remove(el)
+		delete(s.keys, key)
+	}
+
+	s.prune(now)
+	s.keys[key] = s.order.PushFront(&memoryDedupEntry{key: key, expires: now.Add(ttl)})
+	for s.capacity > 0 && s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+
+	return true, nil
+}
+
+// prune удаляет истекшие ключи. Вызывается под mu.
+func (s *MemoryDedupStore) prune(now time.Time) {
+	for el := s.order.Back(); el != nil && !now.Before(el.Value.(*memoryDedupEntry).expires); el = s.order.Back() {
+		s.remove(el)
+	}
+
+	s.adds++
+	if s.adds < max(s.order.Len(), dedupCompactMin) {
+		return
+	}
+	s.adds = 0
+	for el := s.order.Front(); el != nil; {
+		next := el.Next()
+		if !now.Before(el.Value.(*memoryDedupEntry).expires) {
+			s.remove(el)
+		}
+		el = next
+	}
+}
+
+func (s *MemoryDedupStore) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.keys, el.Value.(*memoryDedupEntry).key)
+}
+
+func (s *MemoryDedupStore) Remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.keys[key]; ok {
+		s.order.Remove(el)
+		delete(s.keys, key)
+	}
+
+	return nil
+}
+
+// Len возвращает число хранимых ключей, включая истекшие, но еще не удаленные.
+func (s *MemoryDedupStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len()
+}
+
+// dedupCompactMin наименьшее число добавлений между полными очистками
+// истекших ключей MemoryDedupStore и FileDedupStore
+const dedupCompactMin = 1024
+
+// FileDedupStore хранит ключи в памяти и дописывает изменения в файл,
+// чтобы окно дедупликации переживало перезапуск процесса.
+// Строки файла: "+ключ срок_unix_nano" или "-ключ".
+//
+// Файл переписывается без истекших и удаленных ключей, когда число дописанных
+// строк достигает числа ключей после прошлого сжатия (но не меньше dedupCompactMin),
+// тогда же истекшие ключи удаляются из памяти.
+type FileDedupStore struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	keys     map[string]time.Time
+	appended int // строк дописано после сжатия
+	limit    int // после скольких дописанных строк файл сжимается
+}
+
+// NewFileDedupStore открывает файл хранилища path, загружает не истекшие ключи
+// и переписывает файл без истекших и удаленных ключей.
+func NewFileDedupStore(path string) (*FileDedupStore, error) {
+	s := &FileDedupStore{path: path, keys: make(map[string]time.Time)}
+	if err := s.load(path); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// compact удаляет истекшие ключи и переписывает файл оставшимися ключами.
+func (s *FileDedupStore) compact() error {
+	now := time.Now()
+	for key, expires := range s.keys {
+		if !now.Before(expires) {
+			delete(s.keys, key)
+		}
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for key, expires := range s.keys {
+		fmt.Fprintf(w, "+%s %d\n", key, expires.UnixNano())
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.appended = 0
+	s.limit = max(len(s.keys), dedupCompactMin)
+
+	return nil
+}
+
+// appendLine дописывает строку в файл. Если дописано limit строк, файл сначала
+// сжимается, чтобы при ошибке сжатия изменение не применялось.
+func (s *FileDedupStore) appendLine(line string) error {
+	if s.appended >= s.limit {
+		if err := s.compact(); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintln(s.file, line); err != nil {
+		return err
+	}
+	s.appended++
+
+	return nil
+}
+
+func (s *FileDedupStore) load(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "+"):
+			key, ts, ok := strings.Cut(line[1:], " ")
+			if !ok {
+				continue
+			}
+			nano, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				continue
+			}
+			if expires := time.Unix(0, nano); expires.After(now) {
+				s.keys[key] = expires
+			}
+		case strings.HasPrefix(line, "-"):
+			delete(s.keys, line[1:])
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (s *FileDedupStore) Add(key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if expires, ok := s.keys[key]; ok && now.Before(expires) {
+		return false, nil
+	}
+	expires := now.Add(ttl)
+	if err := s.appendLine(fmt.Sprintf("+%s %d", key, expires.UnixNano())); err != nil {
+		return false, err
+	}
+	s.keys[key] = expires
+
+	return true, nil
+}
+
+func (s *FileDedupStore) Remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key]; !ok {
+		return nil
+	}
+	delete(s.keys, key)
+
+	return s.appendLine("-" + key)
+}
+
+// Close закрывает файл хранилища.
+func (s *FileDedupStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
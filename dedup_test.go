@@ -0,0 +1,279 @@
+package binomv2postback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryDedupStore(t *testing.T) {
+	s := NewMemoryDedupStore(2)
+	for _, tt := range []struct {
+		key  string
+		want bool
+	}{
+		{"a", true},
+		{"a", false},
+		{"b", true},
+		{"c", true}, // вытесняет a
+		{"a", true},
+	} {
+		added, err := s.Add(tt.key, time.Hour)
+		if err != nil || added != tt.want {
+			t.Errorf("Add(%q) = %v, %v, want %v", tt.key, added, err, tt.want)
+		}
+	}
+	if err := s.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if added, _ := s.Add("a", time.Hour); !added {
+		t.Error("removed key is still a duplicate")
+	}
+	if added, _ := s.Add("short", time.Nanosecond); !added {
+		t.Fatal("Add(short) = false")
+	}
+	time.Sleep(time.Millisecond)
+	if added, _ := s.Add("short", time.Hour); !added {
+		t.Error("expired key is still a duplicate")
+	}
+}
+
+func TestMemoryDedupStorePrunesExpired(t *testing.T) {
+	s := NewMemoryDedupStore(0)
+	for i := 0; i < 5000; i++ {
+		if _, err := s.Add(fmt.Sprint("k", i), time.Nanosecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Add("live", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Len(); n != 1 {
+		t.Errorf("Len = %d, want 1", n)
+	}
+
+	// истекший ключ в середине списка удаляется полным проходом
+	s = NewMemoryDedupStore(0)
+	s.Add("old", time.Hour)
+	s.Add("expired", time.Nanosecond)
+	for i := 0; i < 2*dedupCompactMin; i++ {
+		s.Add(fmt.Sprint("k", i), time.Hour)
+	}
+	if _, ok := s.keys["expired"]; ok {
+		t.Error("expired key is kept")
+	}
+}
+
+func TestFileDedupStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup")
+	s, err := NewFileDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add("a", time.Hour)
+	s.Add("b", time.Hour)
+	s.Add("expired", time.Nanosecond)
+	if err := s.Remove("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewFileDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for key, want := range map[string]bool{"a": false, "b": true, "expired": true} {
+		if added, err := s.Add(key, time.Hour); err != nil || added != want {
+			t.Errorf("after reopen Add(%q) = %v, %v, want %v", key, added, err, want)
+		}
+	}
+}
+
+func TestFileDedupStoreCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup")
+	s, err := NewFileDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for i := 0; i < 5000; i++ {
+		if _, err := s.Add(fmt.Sprint("k", i), time.Nanosecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(b), "\n"); lines > dedupCompactMin {
+		t.Errorf("file has %d lines, want at most %d", lines, dedupCompactMin)
+	}
+	if n := len(s.keys); n > dedupCompactMin {
+		t.Errorf("%d keys in memory, want at most %d", n, dedupCompactMin)
+	}
+}
+
+// dedupTracker считает запросы к трекеру и отвечает кодом из status (по умолчанию 200)
+type dedupTracker struct {
+	requests atomic.Int32
+	status   func(n int32) int
+}
+
+func (tr *dedupTracker) Send(req *TransportRequest) (*TransportResponse, error) {
+	n := tr.requests.Add(1)
+	code := http.StatusOK
+	if tr.status != nil {
+		code = tr.status(n)
+	}
+
+	return &TransportResponse{StatusCode: code}, nil
+}
+
+func newDedupTestClient(t *testing.T, tr Transport, opts ...ClientOption) Client {
+	t.Helper()
+	opts = append([]ClientOption{WithClickBaseURL("https://binom.example/click.php"), WithTransport(tr), WithRetryPolicy(RetryPolicy{})}, opts...)
+	cli, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cli
+}
+
+func TestDedupClient(t *testing.T) {
+	tr := &dedupTracker{status: func(n int32) int {
+		if n == 1 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	}}
+	cli := NewDedupClient(newDedupTestClient(t, tr), NewMemoryDedupStore(0), time.Hour)
+	status := "approved"
+	payout, _ := ParseMoney("1.5", "USD")
+
+	// неудачная отправка не занимает ключ
+	if err := cli.SendPostback("c1", &status, &payout, Events{}); err == nil {
+		t.Fatal("first send succeeded")
+	}
+	if err := cli.SendPostback("c1", &status, &payout, Events{}); err != nil {
+		t.Fatalf("retry after failure: %v", err)
+	}
+	if err := cli.SendPostback("c1", &status, &payout, Events{}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("duplicate: %v", err)
+	}
+	req := NewRequestBuilder().WithPayoutMoney(payout).WithStatus(status).Request("c1")
+	if err := cli.SendPostbackRequest(req); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("duplicate request: %v", err)
+	}
+	if err := cli.SendPostback("c1", &status, &payout, Events{}, OptWithIdempotencyKey("n2")); err != nil {
+		t.Errorf("other idempotency key: %v", err)
+	}
+	if n := tr.requests.Load(); n != 3 {
+		t.Errorf("sent %d requests, want 3", n)
+	}
+}
+
+func TestDedupClientWaitsForInflight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var requests atomic.Int32
+	transport := TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		if requests.Add(1) == 1 {
+			close(started)
+			<-release
+			return &TransportResponse{StatusCode: http.StatusInternalServerError}, nil
+		}
+		return &TransportResponse{StatusCode: http.StatusOK}, nil
+	})
+	cli := NewDedupClient(newDedupTestClient(t, transport), NewMemoryDedupStore(0), time.Hour)
+	status := "approved"
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs[0] = cli.SendPostback("c1", &status, nil, Events{})
+	}()
+	<-started
+	go func() {
+		defer wg.Done()
+		errs[1] = cli.SendPostback("c1", &status, nil, Events{})
+	}()
+	// повтор ждет первую отправку, а не получает ErrDuplicate
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if errs[0] == nil || errs[1] != nil {
+		t.Errorf("errors = %v, want first failed and duplicate sent", errs)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+}
+
+func TestDedupClientInflightContext(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	transport := TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		close(started)
+		<-release
+		return &TransportResponse{StatusCode: http.StatusOK}, nil
+	})
+	cli := NewDedupClient(newDedupTestClient(t, transport), NewMemoryDedupStore(0), time.Hour)
+	status := "approved"
+
+	done := make(chan error)
+	go func() {
+		done <- cli.SendPostback("c1", &status, nil, Events{})
+	}()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := cli.SendPostback("c1", &status, nil, Events{}, OptWithContext(ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waiting duplicate: %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.SendPostback("c1", &status, nil, Events{}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("after delivery: %v", err)
+	}
+}
+
+func TestDedupClientEventRegistry(t *testing.T) {
+	registry, err := NewEventRegistry(map[string]int8{"deposit": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &dedupTracker{}
+	dedup := NewDedupClient(newDedupTestClient(t, tr, WithEventRegistry(registry)), NewMemoryDedupStore(0), time.Hour)
+
+	if got := eventRegistryOf(dedup); got != registry {
+		t.Fatalf("eventRegistryOf(DedupClient) = %v", got)
+	}
+	coalescing := NewCoalescingClient(dedup, time.Hour)
+	if err := coalescing.AddNamedEvent("c1", "deposit", 5); err != nil {
+		t.Fatalf("AddNamedEvent through CoalescingClient: %v", err)
+	}
+	if err := coalescing.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := tr.requests.Load(); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
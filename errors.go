@@ -0,0 +1,90 @@
+package binomv2postback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrEventIndexOutOfRange номер события вне диапазона событий трекера
+	ErrEventIndexOutOfRange = errors.New("event index out of range")
+	// ErrEventAlreadySet событие с таким номером уже есть в Events
+	ErrEventAlreadySet = errors.New("event already set")
+	// ErrEmptyUpdate обновление клика без событий не отправлено в трекер, см. WithEmptyUpdateError
+	ErrEmptyUpdate = errors.New("empty update")
+)
+
+// HTTPStatusError трекер ответил неуспешным кодом.
+// URL хранится с вырезанными ключами (upd_key, api_key).
+// Если ответ распознан, Err содержит причину (например ErrClickNotFound).
+type HTTPStatusError struct {
+	StatusCode int
+	URL        string
+	Body       string
+	Header     http.Header // заголовки ответа, например Retry-After
+	Err        error
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("failed to send request %s, status code: %d, response %s", e.URL, e.StatusCode, e.Body)
+}
+
+func (e *HTTPStatusError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable сообщает, имеет ли смысл повторить запрос (429 и 5xx).
+func (e *HTTPStatusError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// TransportError запрос не дошел до трекера или ответ не удалось прочитать.
+type TransportError struct {
+	URL string
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("binom transport error %s: %v", e.URL, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable сообщает, имеет ли смысл повторить запрос.
+// Отмененный запрос не повторяется, а таймаут считается временной ошибкой.
+func (e *TransportError) Retryable() bool {
+	return !errors.Is(e.Err, context.Canceled)
+}
+
+// IsRetryable сообщает, является ли ошибка временной: ошибка транспорта,
+// 429 или 5xx ответ трекера. Остальные ошибки считаются постоянными.
+func IsRetryable(err error) bool {
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+
+	return false
+}
+
+// ErrMissingClickID во входящем запросе нет ID клика
+var ErrMissingClickID = errors.New("missing click id")
+
+// ParamError неверное значение аргумента входящего postback запроса.
+type ParamError struct {
+	Param string
+	Value string
+	Err   error
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("invalid param %s=%q: %v", e.Param, e.Value, e.Err)
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,145 @@
+package binomv2postback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain", errors.New("x"), false},
+		{"429", &HTTPStatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"500", &HTTPStatusError{StatusCode: http.StatusInternalServerError}, true},
+		{"503 wrapped", fmt.Errorf("send: %w", &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}), true},
+		{"400", &HTTPStatusError{StatusCode: http.StatusBadRequest}, false},
+		{"404 click not found", &HTTPStatusError{StatusCode: http.StatusNotFound, Err: ErrClickNotFound}, false},
+		{"transport", &TransportError{Err: errors.New("connection refused")}, true},
+		{"transport timeout", &TransportError{Err: context.DeadlineExceeded}, true},
+		{"transport canceled", &TransportError{Err: fmt.Errorf("do: %w", context.Canceled)}, false},
+		{"tracker error", &TrackerError{Err: ErrInvalidUPDKey}, false},
+		{"empty update", ErrEmptyUpdate, false},
+		{"context canceled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPStatusErrorUnwrap(t *testing.T) {
+	tr := TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		return &TransportResponse{
+			StatusCode: http.StatusNotFound,
+			Header:     http.Header{"Retry-After": {"5"}},
+			Body:       []byte("Click not found."),
+		}, nil
+	})
+	cli := newDedupTestClient(t, tr, WithUPDKey("secret"))
+	err := cli.SendEvent("c1", binom.Event(1, 1))
+
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("err = %T %v, want *HTTPStatusError", err, err)
+	}
+	if !errors.Is(err, ErrClickNotFound) {
+		t.Errorf("errors.Is(ErrClickNotFound) = false for %v", err)
+	}
+	if statusErr.StatusCode != http.StatusNotFound || statusErr.Body != "Click not found." || statusErr.Header.Get("Retry-After") != "5" {
+		t.Errorf("status error = %+v", statusErr)
+	}
+	if strings.Contains(statusErr.URL, "secret") || strings.Contains(err.Error(), "secret") || !strings.Contains(statusErr.URL, "upd_key=REDACTED") {
+		t.Errorf("URL is not redacted: %s", statusErr.URL)
+	}
+	if IsRetryable(err) {
+		t.Error("404 is retryable")
+	}
+}
+
+func TestTransportErrorUnwrap(t *testing.T) {
+	netErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tr := TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		return nil, netErr
+	})
+	cli := newDedupTestClient(t, tr, WithUPDKey("secret"))
+	err := cli.SendEvent("c1", binom.Event(1, 1))
+
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) {
+		t.Fatalf("err = %T %v, want *TransportError", err, err)
+	}
+	var opErr *net.OpError
+	if !errors.Is(err, netErr) || !errors.As(err, &opErr) {
+		t.Errorf("transport error does not unwrap to the net error: %v", err)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("secret in the error: %v", err)
+	}
+	if !IsRetryable(err) {
+		t.Error("transport error is not retryable")
+	}
+
+	// готовый TransportError транспорта не оборачивается второй раз
+	own := &TransportError{URL: "x", Err: context.Canceled}
+	cli = newDedupTestClient(t, TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		return nil, own
+	}))
+	if err := cli.SendEvent("c1", binom.Event(1, 1)); err != own || IsRetryable(err) || !errors.Is(err, context.Canceled) {
+		t.Errorf("transport's own error: %v", err)
+	}
+}
+
+func TestEmptyUpdateError(t *testing.T) {
+	var requests int
+	tr := TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		requests++
+		return &TransportResponse{StatusCode: http.StatusOK}, nil
+	})
+
+	// по умолчанию пропуск пустого обновления не ошибка
+	var resp Response
+	cli := newDedupTestClient(t, tr)
+	if err := cli.SendEvents("c1", Events{}, OptWithResponse(&resp)); err != nil {
+		t.Errorf("empty update without opt-in: %v", err)
+	}
+	if resp.Result != ResultSkipped {
+		t.Errorf("Result = %s, want %s", resp.Result, ResultSkipped)
+	}
+
+	cli = newDedupTestClient(t, tr, WithEmptyUpdateError(true))
+	if err := cli.SendEvents("c1", Events{}); !errors.Is(err, ErrEmptyUpdate) {
+		t.Errorf("SendEvents: %v", err)
+	}
+	if err := cli.SendPostbackRequest(NewRequestBuilder().Request("c1")); !errors.Is(err, ErrEmptyUpdate) {
+		t.Errorf("SendPostbackRequest without conversion: %v", err)
+	}
+	// конверсия без событий не пустое обновление
+	status := "approved"
+	if err := cli.SendPostback("c1", &status, nil, Events{}); err != nil {
+		t.Errorf("conversion: %v", err)
+	}
+	if IsRetryable(ErrEmptyUpdate) {
+		t.Error("ErrEmptyUpdate is retryable")
+	}
+
+	// с WithEmptyUpdates пустое обновление отправляется
+	cli = newDedupTestClient(t, tr, WithEmptyUpdates(true), WithEmptyUpdateError(true))
+	if err := cli.SendEvents("c1", Events{}); err != nil {
+		t.Errorf("WithEmptyUpdates: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("sent %d requests, want 2", requests)
+	}
+}
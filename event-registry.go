@@ -0,0 +1,195 @@
+package binomv2postback
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+var (
+	// ErrUnknownEventName имени события нет в EventRegistry
+	ErrUnknownEventName = errors.New("unknown event name")
+	// ErrEventNameConflict имя или номер события уже заняты в EventRegistry
+	ErrEventNameConflict = errors.New("event name conflict")
+)
+
+// EventRegistry сопоставляет бизнес-события ("registration", "deposit", "ftd")
+// номерам событий трекера 1..MaxEventIndex.
+type EventRegistry struct {
+	byName  map[string]int8
+	byIndex map[int8]string
+}
+
+// NewEventRegistry создает реестр из пар имя - номер события.
+// Номер вне 1..MaxEventIndex, пустое имя и два имени на один номер дают ошибку.
+func NewEventRegistry(events map[string]int8) (*EventRegistry, error) {
+	r := &EventRegistry{
+		byName:  make(map[string]int8, len(events)),
+		byIndex: make(map[int8]string, len(events)),
+	}
+	// порядок имен фиксирован, чтобы ошибка о конфликте была одной и той же
+	names := make([]string, 0, len(events))
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := r.Register(name, events[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Register добавляет событие name с номером index.
+func (r *EventRegistry) Register(name string, index int8) error {
+	if name == "" {
+		return errors.New("empty event name")
+	}
+	if index < 1 || index > MaxEventIndex {
+		return fmt.Errorf("event %q: %w: %d. Max: %d", name, ErrEventIndexOutOfRange, index, MaxEventIndex)
+	}
+	if prev, ok := r.byName[name]; ok && prev != index {
+		return fmt.Errorf("%w: event %q is already event%d", ErrEventNameConflict, name, prev)
+	}
+	if prev, ok := r.byIndex[index]; ok && prev != name {
+		return fmt.Errorf("%w: event%d is already %q, not %q", ErrEventNameConflict, index, prev, name)
+	}
+	r.byName[name] = index
+	r.byIndex[index] = name
+
+	return nil
+}
+
+// Index возвращает номер события name.
+func (r *EventRegistry) Index(name string) (int8, error) {
+	if r != nil {
+		if index, ok := r.byName[name]; ok {
+			return index, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %q", ErrUnknownEventName, name)
+}
+
+// Name возвращает имя события с номером index.
+func (r *EventRegistry) Name(index int8) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	name, ok := r.byIndex[index]
+
+	return name, ok
+}
+
+// Names возвращает имена событий по возрастанию номера.
+func (r *EventRegistry) Names() []string {
+	if r == nil {
+		return nil
+	}
+	indices := make([]int, 0, len(r.byIndex))
+	for index := range r.byIndex {
+		indices = append(indices, int(index))
+	}
+	sort.Ints(indices)
+	names := make([]string, 0, len(indices))
+	for _, index := range indices {
+		names = append(names, r.byIndex[int8(index)])
+	}
+
+	return names
+}
+
+// Event создает событие name, устанавливающее значение val (eventX=val).
+func (r *EventRegistry) Event(name string, val int64) (Event, error) {
+	index, err := r.Index(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return binom.Event(index, val), nil
+}
+
+// AddEvent создает событие name, прибавляющее val (add_eventX=val).
+func (r *EventRegistry) AddEvent(name string, val int64) (Event, error) {
+	index, err := r.Index(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return binom.AddEvent(index, val), nil
+}
+
+// Format выводит события с именами для логов: "registration=1, deposit+=50, event7=2".
+// События без имени выводятся как URL-аргументы.
+func (r *EventRegistry) Format(events Events) string {
+	parts := make([]string, 0, events.Len())
+	events.Range(func(ev Event) bool {
+		name, ok := r.Name(ev.Index())
+		switch {
+		case !ok:
+			parts = append(parts, ev.URLParam())
+		case ev.Type() == "add_event":
+			parts = append(parts, name+"+="+strconv.FormatInt(ev.Value(), 10))
+		default:
+			parts = append(parts, name+"="+strconv.FormatInt(ev.Value(), 10))
+		}
+		return true
+	})
+
+	return strings.Join(parts, ", ")
+}
+
+// WithEventRegistry задает реестр имен событий для AddNamedEvent и SetNamedEvent.
+func WithEventRegistry(registry *EventRegistry) ClientOption {
+	return func(cli *client) error {
+		if registry == nil {
+			return errors.New("nil event registry")
+		}
+		cli.events = registry
+		return nil
+	}
+}
+
+// eventRegistryProvider клиент, у которого есть реестр имен событий
+type eventRegistryProvider interface {
+	eventRegistry() *EventRegistry
+}
+
+// eventRegistryOf возвращает реестр имен событий клиента или nil.
+func eventRegistryOf(cli Client) *EventRegistry {
+	if p, ok := cli.(eventRegistryProvider); ok {
+		return p.eventRegistry()
+	}
+
+	return nil
+}
+
+func (cli *client) eventRegistry() *EventRegistry {
+	return cli.events
+}
+
+// AddNamedEvent прибавляет val к событию name из реестра WithEventRegistry
+func (cli *client) AddNamedEvent(clickID string, name string, val int64, opts ...sendClickOpt) error {
+	ev, err := cli.events.AddEvent(name, val)
+	if err != nil {
+		return err
+	}
+
+	return cli.SendEvent(clickID, ev, opts...)
+}
+
+// SetNamedEvent устанавливает событие name из реестра WithEventRegistry в val
+func (cli *client) SetNamedEvent(clickID string, name string, val int64, opts ...sendClickOpt) error {
+	ev, err := cli.events.Event(name, val)
+	if err != nil {
+		return err
+	}
+
+	return cli.SendEvent(clickID, ev, opts...)
+}
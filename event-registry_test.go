@@ -0,0 +1,199 @@
+package binomv2postback
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+func TestNewEventRegistry(t *testing.T) {
+	for name, events := range map[string]map[string]int8{
+		"empty name":   {"": 1},
+		"index 0":      {"registration": 0},
+		"index 31":     {"registration": MaxEventIndex + 1},
+		"shared index": {"registration": 1, "signup": 1},
+	} {
+		if _, err := NewEventRegistry(events); err == nil {
+			t.Errorf("%s: registry created", name)
+		}
+	}
+	if _, err := NewEventRegistry(map[string]int8{"a": 2, "b": 2}); !errors.Is(err, ErrEventNameConflict) || !strings.Contains(err.Error(), `"a"`) {
+		t.Errorf("shared index: %v", err)
+	}
+
+	r, err := NewEventRegistry(map[string]int8{"deposit": 3, "registration": 1, "ftd": MaxEventIndex})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("deposit", 3); err != nil {
+		t.Errorf("registering the same pair again: %v", err)
+	}
+	if err := r.Register("deposit", 4); !errors.Is(err, ErrEventNameConflict) {
+		t.Errorf("deposit -> 4: %v", err)
+	}
+	if err := r.Register("payout", 1); !errors.Is(err, ErrEventNameConflict) {
+		t.Errorf("payout -> 1: %v", err)
+	}
+	if err := r.Register("payout", 5); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(r.Names(), ","); got != "registration,deposit,payout,ftd" {
+		t.Errorf("Names = %s", got)
+	}
+}
+
+func TestEventRegistryLookup(t *testing.T) {
+	r, err := NewEventRegistry(map[string]int8{"registration": 1, "deposit": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index, err := r.Index("deposit"); err != nil || index != 3 {
+		t.Errorf("Index(deposit) = %d, %v", index, err)
+	}
+	if _, err := r.Index("withdrawal"); !errors.Is(err, ErrUnknownEventName) || !strings.Contains(err.Error(), "withdrawal") {
+		t.Errorf("Index(withdrawal): %v", err)
+	}
+	if name, ok := r.Name(1); !ok || name != "registration" {
+		t.Errorf("Name(1) = %q, %v", name, ok)
+	}
+	if _, ok := r.Name(2); ok {
+		t.Error("Name(2) found")
+	}
+
+	var nilRegistry *EventRegistry
+	if _, err := nilRegistry.Index("deposit"); !errors.Is(err, ErrUnknownEventName) {
+		t.Errorf("nil registry Index: %v", err)
+	}
+	if _, ok := nilRegistry.Name(1); ok || nilRegistry.Names() != nil {
+		t.Error("nil registry has names")
+	}
+
+	ev, err := r.AddEvent("deposit", 50)
+	if err != nil || ev.URLParam() != "add_event3=50" {
+		t.Errorf("AddEvent = %v, %v", ev, err)
+	}
+	ev, err = r.Event("registration", 1)
+	if err != nil || ev.URLParam() != "event1=1" {
+		t.Errorf("Event = %v, %v", ev, err)
+	}
+	if _, err := r.Event("withdrawal", 1); !errors.Is(err, ErrUnknownEventName) {
+		t.Errorf("Event(withdrawal): %v", err)
+	}
+
+	events := mustEvents(t, binom.AddEvent(3, 50), binom.Event(7, 2), ev)
+	if got := r.Format(events); got != "registration=1, deposit+=50, event7=2" {
+		t.Errorf("Format = %s", got)
+	}
+	if got := nilRegistry.Format(events); got != "event1=1, add_event3=50, event7=2" {
+		t.Errorf("Format without registry = %s", got)
+	}
+}
+
+func TestClientNamedEvents(t *testing.T) {
+	if _, err := New(WithEventRegistry(nil)); err == nil {
+		t.Error("nil registry accepted")
+	}
+	r, err := NewEventRegistry(map[string]int8{"deposit": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &coalesceTracker{}
+	cli := newDedupTestClient(t, tr, WithEventRegistry(r))
+	if err := cli.AddNamedEvent("c1", "deposit", 50); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.SetNamedEvent("c1", "deposit", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.AddNamedEvent("c1", "withdrawal", 1); !errors.Is(err, ErrUnknownEventName) {
+		t.Errorf("unknown name: %v", err)
+	}
+	sent := tr.sent()
+	if len(sent) != 2 || sent[0].Get("add_event3") != "50" || sent[1].Get("event3") != "0" {
+		t.Errorf("sent %v", sent)
+	}
+
+	// клиент без реестра не знает ни одного имени
+	plain := newDedupTestClient(t, tr)
+	if err := plain.SetNamedEvent("c1", "deposit", 1); !errors.Is(err, ErrUnknownEventName) {
+		t.Errorf("client without registry: %v", err)
+	}
+	if len(tr.sent()) != 2 {
+		t.Errorf("unknown names were sent: %v", tr.sent())
+	}
+}
+
+// namedEventClient клиент-обертка с событиями по именам
+type namedEventClient interface {
+	AddNamedEvent(clickID string, name string, val int64, opts ...sendClickOpt) error
+	SetNamedEvent(clickID string, name string, val int64, opts ...sendClickOpt) error
+}
+
+func TestWrappedClientsNamedEvents(t *testing.T) {
+	r, err := NewEventRegistry(map[string]int8{"deposit": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrappers := []struct {
+		name string
+		wrap func(cli Client) (namedEventClient, func() error)
+	}{
+		{"AsyncClient", func(cli Client) (namedEventClient, func() error) {
+			a := NewAsyncClient(cli)
+			return a, func() error { return a.Close(context.Background()) }
+		}},
+		{"CoalescingClient", func(cli Client) (namedEventClient, func() error) {
+			c := NewCoalescingClient(cli, time.Hour)
+			return c, func() error { return c.Close(context.Background()) }
+		}},
+		{"DedupClient", func(cli Client) (namedEventClient, func() error) {
+			return NewDedupClient(cli, NewMemoryDedupStore(0), time.Hour), func() error { return nil }
+		}},
+		{"Outbox", func(cli Client) (namedEventClient, func() error) {
+			o, err := NewOutbox(cli, filepath.Join(t.TempDir(), "outbox.jsonl"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			o.Start(context.Background())
+			return o, func() error {
+				waitOutbox(t, func() bool { return o.Pending() == 0 })
+				return o.Close()
+			}
+		}},
+		// обертка над оберткой находит реестр внутреннего клиента
+		{"AsyncClient(DedupClient)", func(cli Client) (namedEventClient, func() error) {
+			a := NewAsyncClient(NewDedupClient(cli, NewMemoryDedupStore(0), time.Hour))
+			return a, func() error { return a.Close(context.Background()) }
+		}},
+	}
+	for _, w := range wrappers {
+		tr := &coalesceTracker{}
+		c, closeFn := w.wrap(newDedupTestClient(t, tr, WithEventRegistry(r)))
+		if got := c.(eventRegistryProvider).eventRegistry(); got != r {
+			t.Errorf("%s: eventRegistry = %v", w.name, got)
+		}
+		if err := c.AddNamedEvent("c1", "deposit", 50); err != nil {
+			t.Errorf("%s: AddNamedEvent: %v", w.name, err)
+		}
+		if err := c.SetNamedEvent("c2", "deposit", 7); err != nil {
+			t.Errorf("%s: SetNamedEvent: %v", w.name, err)
+		}
+		if err := c.AddNamedEvent("c1", "withdrawal", 1); !errors.Is(err, ErrUnknownEventName) {
+			t.Errorf("%s: unknown name: %v", w.name, err)
+		}
+		if err := closeFn(); err != nil {
+			t.Fatalf("%s: close: %v", w.name, err)
+		}
+		waitOutbox(t, func() bool { return len(tr.sent()) == 2 })
+		for _, q := range tr.sent() {
+			if (q.Get("upd_clickid") == "c1" && q.Get("add_event3") != "50") || (q.Get("upd_clickid") == "c2" && q.Get("event3") != "7") {
+				t.Errorf("%s: sent %v", w.name, q)
+			}
+		}
+	}
+}
@@ -2,7 +2,10 @@ package binomv2postback
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
 )
 
 // Event представляет собой событие в биноме. https://docs.binom.org/events-v2.php
@@ -16,43 +19,146 @@ type Event interface {
 	URLParam() string // форматирование значения в виде URL-аргумента
 }
 
-// События в трекере (всего их 30)
-type Events [30]Event
+// MaxEventIndex наибольший номер события в трекере, события нумеруются с 1
+const MaxEventIndex = 30
+
+// Events события клика по номерам 1..MaxEventIndex. Хранятся только
+// установленные события в порядке номеров, поэтому URL-аргументы всегда
+// выводятся в одном порядке. Нулевое значение Events{} - пустой набор.
+// Events можно копировать как значение: изменения копии не затрагивают оригинал.
+type Events struct {
+	list []Event // по возрастанию Index(), без nil и повторов
+}
+
+// NewEvents создает Events из событий, более позднее событие с тем же номером заменяет раннее.
+func NewEvents(events ...Event) (Events, error) {
+	e := Events{}
+	for _, ev := range events {
+		if err := e.Set(ev, true); err != nil {
+			return Events{}, err
+		}
+	}
+
+	return e, nil
+}
 
 // Params возвращает все события как параметры
 func (e *Events) Params() []string {
 	out := []string{}
-	for _, v := range *e {
-		if v == nil {
-			continue
-		}
+	for _, v := range e.list {
 		out = append(out, v.URLParam())
 	}
 
 	return out
 }
 
-// String преобразует массив Events в строку
+// String преобразует Events в строку
 func (e *Events) String() string {
 	return strings.Join(e.Params(), ":")
 }
 
-// URLParams преобразует массив Events в строку URL-аргументов
+// URLParams преобразует Events в строку URL-аргументов
 func (e *Events) URLParams() string {
 	return strings.Join(e.Params(), "&")
 }
 
-// Set проверяет наличие события в массиве и устанавливает конкретное событие index=X
-// если force=true, либо выбрасывает ошибку (TODO: конкретная ошибка)
+// Len возвращает число установленных событий.
+func (e *Events) Len() int {
+	return len(e.list)
+}
+
+// Get возвращает событие с номером index.
+func (e *Events) Get(index int8) (Event, bool) {
+	if i, ok := e.search(index); ok {
+		return e.list[i], true
+	}
+
+	return nil, false
+}
+
+// Delete удаляет событие с номером index.
+func (e *Events) Delete(index int8) {
+	i, ok := e.search(index)
+	if !ok {
+		return
+	}
+	list := make([]Event, 0, len(e.list)-1)
+	list = append(list, e.list[:i]...)
+	e.list = append(list, e.list[i+1:]...)
+}
+
+// Range вызывает f для событий по возрастанию номера, пока f возвращает true.
+func (e *Events) Range(f func(ev Event) bool) {
+	for _, ev := range e.list {
+		if !f(ev) {
+			return
+		}
+	}
+}
+
+// List возвращает события по возрастанию номера.
+func (e *Events) List() []Event {
+	return append([]Event(nil), e.list...)
+}
+
+// Set проверяет наличие события и устанавливает событие с номером index=X
+// если force=true, либо возвращает ErrEventAlreadySet.
+// Для номера вне 1..MaxEventIndex возвращает ErrEventIndexOutOfRange.
 func (e *Events) Set(ev Event, force bool) error {
 	index := ev.Index()
-	if int(index) > cap(e) {
-		return fmt.Errorf("event index out of range. Max: %d", cap(e))
+	if index < 1 || index > MaxEventIndex {
+		return fmt.Errorf("%w: %d. Max: %d", ErrEventIndexOutOfRange, index, MaxEventIndex)
 	}
-	if v := e[index]; v != nil && !force {
-		return fmt.Errorf("event %d already set %v", index, v)
+	i, ok := e.search(index)
+	if ok && !force {
+		return fmt.Errorf("%w: event %d %v", ErrEventAlreadySet, index, e.list[i])
 	}
-	e[index] = ev
+	e.put(i, ok, ev)
 
 	return nil
 }
+
+// Merge добавляет к Events события other.
+// add_event складываются, событие event заменяет прежнее значение,
+// а add_event после event дает event с суммарным значением.
+func (e *Events) Merge(other Events) {
+	for _, ev := range other.list {
+		i, ok := e.search(ev.Index())
+		if ok {
+			ev = mergeEvent(e.list[i], ev)
+		}
+		e.put(i, ok, ev)
+	}
+}
+
+// search ищет позицию события index в списке.
+func (e *Events) search(index int8) (int, bool) {
+	i := sort.Search(len(e.list), func(i int) bool { return e.list[i].Index() >= index })
+
+	return i, i < len(e.list) && e.list[i].Index() == index
+}
+
+// put заменяет (replace=true) или вставляет событие в позицию i.
+// Список всегда копируется, чтобы копии Events не делили изменения.
+func (e *Events) put(i int, replace bool, ev Event) {
+	list := make([]Event, 0, len(e.list)+1)
+	list = append(list, e.list[:i]...)
+	list = append(list, ev)
+	if replace {
+		i++
+	}
+	e.list = append(list, e.list[i:]...)
+}
+
+// mergeEvent объединяет событие prev с последующим обновлением next того же номера.
+func mergeEvent(prev, next Event) Event {
+	if prev == nil || next.Type() == "event" {
+		return next
+	}
+	value := prev.Value() + next.Value()
+	if prev.Type() == "event" {
+		return binom.Event(next.Index(), value)
+	}
+
+	return binom.AddEvent(next.Index(), value)
+}
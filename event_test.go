@@ -0,0 +1,113 @@
+package binomv2postback
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+func TestEventsSet(t *testing.T) {
+	e := Events{}
+	if err := e.Set(binom.Event(3, 1), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Set(binom.Event(3, 2), false); !errors.Is(err, ErrEventAlreadySet) {
+		t.Errorf("Set without force: %v", err)
+	}
+	if err := e.Set(binom.AddEvent(3, 5), true); err != nil {
+		t.Fatal(err)
+	}
+	if ev, ok := e.Get(3); !ok || ev.Type() != "add_event" || ev.Value() != 5 {
+		t.Errorf("Get(3) = %v, %v", ev, ok)
+	}
+	for _, index := range []int8{0, -1, MaxEventIndex + 1} {
+		if err := e.Set(binom.Event(index, 1), true); !errors.Is(err, ErrEventIndexOutOfRange) {
+			t.Errorf("Set(%d): %v", index, err)
+		}
+	}
+	if err := e.Set(binom.Event(MaxEventIndex, 1), false); err != nil {
+		t.Errorf("Set(%d): %v", MaxEventIndex, err)
+	}
+	if n := e.Len(); n != 2 {
+		t.Errorf("Len = %d, want 2", n)
+	}
+
+	e.Delete(3)
+	e.Delete(4)
+	if _, ok := e.Get(3); ok || e.Len() != 1 {
+		t.Errorf("after Delete: %s", e.URLParams())
+	}
+}
+
+func TestEventsOrder(t *testing.T) {
+	e, err := NewEvents(binom.Event(30, 1), binom.AddEvent(2, -1), binom.Event(11, 7), binom.Event(1, 0), binom.Event(11, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.URLParams(), "event1=0&add_event2=-1&event11=8&event30=1"; got != want {
+		t.Errorf("URLParams = %s, want %s", got, want)
+	}
+	if got, want := e.String(), "event1=0:add_event2=-1:event11=8:event30=1"; got != want {
+		t.Errorf("String = %s, want %s", got, want)
+	}
+
+	var indexes []int8
+	e.Range(func(ev Event) bool {
+		indexes = append(indexes, ev.Index())
+		return ev.Index() < 11
+	})
+	if len(indexes) != 3 || indexes[2] != 11 {
+		t.Errorf("Range stopped at %v", indexes)
+	}
+	if list := e.List(); len(list) != 4 || list[0].Index() != 1 || list[3].Index() != 30 {
+		t.Errorf("List = %v", list)
+	}
+	if empty := (Events{}); empty.URLParams() != "" || len(empty.Params()) != 0 {
+		t.Errorf("empty Events = %q", empty.URLParams())
+	}
+}
+
+func TestEventsCopy(t *testing.T) {
+	e, _ := NewEvents(binom.Event(1, 1), binom.Event(2, 2))
+	cp := e
+	cp.Set(binom.Event(1, 10), true)
+	cp.Set(binom.Event(3, 3), false)
+	cp.Delete(2)
+	if got := e.URLParams(); got != "event1=1&event2=2" {
+		t.Errorf("original changed with its copy: %s", got)
+	}
+
+	list := e.List()
+	list[0] = binom.Event(1, 100)
+	if ev, _ := e.Get(1); ev.Value() != 1 {
+		t.Error("List shares the events")
+	}
+}
+
+func TestEventsMerge(t *testing.T) {
+	tests := []struct {
+		name        string
+		base, other []Event
+		want        string
+	}{
+		{"add+add", []Event{binom.AddEvent(1, 2)}, []Event{binom.AddEvent(1, 3)}, "add_event1=5"},
+		{"event+add", []Event{binom.Event(1, 2)}, []Event{binom.AddEvent(1, -1)}, "event1=1"},
+		{"add+event", []Event{binom.AddEvent(1, 2)}, []Event{binom.Event(1, 7)}, "event1=7"},
+		{"event+event", []Event{binom.Event(1, 2)}, []Event{binom.Event(1, 0)}, "event1=0"},
+		{"disjoint", []Event{binom.Event(5, 1)}, []Event{binom.AddEvent(2, 1), binom.Event(9, 1)}, "add_event2=1&event5=1&event9=1"},
+		{"empty", nil, []Event{binom.Event(5, 1)}, "event5=1"},
+	}
+	for _, tt := range tests {
+		base, _ := NewEvents(tt.base...)
+		other, _ := NewEvents(tt.other...)
+		orig := other.URLParams()
+		base.Merge(other)
+		if got := base.URLParams(); got != tt.want {
+			t.Errorf("%s: Merge = %s, want %s", tt.name, got, tt.want)
+		}
+		if other.URLParams() != orig {
+			t.Errorf("%s: Merge changed its argument", tt.name)
+		}
+	}
+}
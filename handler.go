@@ -0,0 +1,102 @@
+package binomv2postback
+
+import (
+	"errors"
+	"net/http"
+)
+
+// RequestHandler обрабатывает входящий postback, разобранный в Request.
+type RequestHandler func(r *http.Request, req Request) error
+
+// PostbackHandler принимает postback от партнерской сети в формате Binom,
+// разбирает его аргументы (ParseQuery) и передает Request в RequestHandler.
+//
+// Код ответа говорит сети, стоит ли повторять postback:
+//   - 200 - обработан, а также ErrDuplicate и ErrEmptyUpdate (повторять нечего);
+//   - 400 - неверные аргументы или данные запроса;
+//   - 409 - недопустимый переход статуса конверсии;
+//   - 422 - трекер окончательно отклонил запрос (клик не найден, неповторяемый код ответа);
+//   - 502 - временная или неизвестная ошибка, запрос стоит повторить.
+type PostbackHandler struct {
+	handle RequestHandler
+	log    Logger
+}
+
+// NewPostbackHandler создает http.Handler входящих postback запросов.
+func NewPostbackHandler(handle RequestHandler) *PostbackHandler {
+	return &PostbackHandler{handle: handle}
+}
+
+// SetLogger задает логгер для отклоненных запросов.
+func (h *PostbackHandler) SetLogger(log Logger) {
+	h.log = log
+}
+
+func (h *PostbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	// для POST аргументы могут прийти и в теле формы
+	if err := r.ParseForm(); err != nil {
+		h.reject(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	req, err := ParseQuery(r.Form)
+	if err != nil {
+		h.reject(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.handle(r, req); err != nil {
+		if code := handlerStatus(err); code != http.StatusOK {
+			h.reject(w, r, code, err)
+			return
+		}
+		if h.log != nil {
+			h.log.Infof("postback %s accepted without sending: %v", redactURL(r.URL), err)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// handlerStatus выбирает код ответа для ошибки RequestHandler.
+func handlerStatus(err error) int {
+	var paramErr *ParamError
+	var statusErr *HTTPStatusError
+	switch {
+	case errors.Is(err, ErrDuplicate), errors.Is(err, ErrEmptyUpdate):
+		return http.StatusOK
+	case errors.As(err, &paramErr), errors.Is(err, ErrMissingClickID), errors.Is(err, ErrInvalidMoney),
+		errors.Is(err, ErrUnknownCurrency), errors.Is(err, ErrEventIndexOutOfRange), errors.Is(err, ErrUnknownEventName):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrIllegalStatusTransition), errors.Is(err, ErrUnknownStatus):
+		return http.StatusConflict
+	case errors.Is(err, ErrClickNotFound), errors.As(err, &statusErr) && !statusErr.Retryable():
+		return http.StatusUnprocessableEntity
+	}
+
+	return http.StatusBadGateway
+}
+
+func (h *PostbackHandler) reject(w http.ResponseWriter, r *http.Request, code int, err error) {
+	if h.log != nil {
+		h.log.Errorf("postback %s rejected with %d: %v", redactURL(r.URL), code, err)
+	}
+	// детали ошибки трекера наружу не отдаем
+	msg := http.StatusText(code)
+	if code == http.StatusBadRequest || code == http.StatusConflict {
+		msg = err.Error()
+	}
+	http.Error(w, msg, code)
+}
+
+// ForwardTo возвращает RequestHandler, отправляющий входящий postback в трекер через cli.
+func ForwardTo(cli PostbackClient, opts ...sendClickOpt) RequestHandler {
+	return func(r *http.Request, req Request) error {
+		return cli.SendPostbackRequest(req, append([]sendClickOpt{OptWithContext(r.Context())}, opts...)...)
+	}
+}
@@ -0,0 +1,128 @@
+package binomv2postback
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPostbackHandlerParses(t *testing.T) {
+	var got Request
+	srv := httptest.NewServer(NewPostbackHandler(func(r *http.Request, req Request) error {
+		got = req
+		return nil
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/postback?cnv_id=abc&payout=1.50&cnv_status=approved&event2=3&unknown=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("GET = %d %q", resp.StatusCode, body)
+	}
+	if got == nil || got.ClickID() != "abc" || got.Payout() != "1.5" || got.ConversionStatus() != "approved" || !got.IsConversion() {
+		t.Fatalf("request = %v", got)
+	}
+	events := got.Events()
+	if ev, ok := events.Get(2); !ok || ev.Value() != 3 {
+		t.Errorf("event2 = %v, %v", ev, ok)
+	}
+
+	// аргументы POST формы
+	resp, err = http.PostForm(srv.URL+"/postback", url.Values{"clickid": {"def"}, "add_event1": {"1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || got.ClickID() != "def" || got.IsConversion() {
+		t.Errorf("POST = %d, request %v", resp.StatusCode, got)
+	}
+}
+
+func TestPostbackHandlerStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		err    error
+		want   int
+	}{
+		{"ok", http.MethodGet, "cnv_id=a", nil, http.StatusOK},
+		{"method", http.MethodPut, "cnv_id=a", nil, http.StatusMethodNotAllowed},
+		{"missing click id", http.MethodGet, "payout=1", nil, http.StatusBadRequest},
+		{"invalid payout", http.MethodGet, "cnv_id=a&payout=x", nil, http.StatusBadRequest},
+		{"duplicate", http.MethodGet, "cnv_id=a", ErrDuplicate, http.StatusOK},
+		{"empty update", http.MethodGet, "clickid=a", fmt.Errorf("send: %w", ErrEmptyUpdate), http.StatusOK},
+		{"validation", http.MethodGet, "cnv_id=a", &ParamError{Param: "cnv_currency", Err: ErrUnknownCurrency}, http.StatusBadRequest},
+		{"unknown event name", http.MethodGet, "cnv_id=a", ErrUnknownEventName, http.StatusBadRequest},
+		{"transition", http.MethodGet, "cnv_id=a", &StatusTransitionError{ClickID: "a", From: "b", To: "a", Err: ErrIllegalStatusTransition}, http.StatusConflict},
+		{"click not found", http.MethodGet, "cnv_id=a", &TrackerError{Message: "click not found", Err: ErrClickNotFound}, http.StatusUnprocessableEntity},
+		{"tracker 400", http.MethodGet, "cnv_id=a", &HTTPStatusError{StatusCode: http.StatusBadRequest}, http.StatusUnprocessableEntity},
+		{"tracker 503", http.MethodGet, "cnv_id=a", &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, http.StatusBadGateway},
+		{"transport", http.MethodGet, "cnv_id=a", &TransportError{Err: errors.New("timeout")}, http.StatusBadGateway},
+		{"unknown", http.MethodGet, "cnv_id=a", errors.New("boom"), http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		h := NewPostbackHandler(func(r *http.Request, req Request) error {
+			return tt.err
+		})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, "/postback?"+tt.query, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, rec.Code, tt.want, strings.TrimSpace(rec.Body.String()))
+		}
+	}
+}
+
+func TestPostbackHandlerHidesTrackerDetails(t *testing.T) {
+	h := NewPostbackHandler(func(r *http.Request, req Request) error {
+		return &HTTPStatusError{StatusCode: http.StatusInternalServerError, URL: "https://binom.example/click.php?upd_key=secret"}
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/postback?cnv_id=a", nil))
+	if strings.Contains(rec.Body.String(), "binom.example") {
+		t.Errorf("tracker error leaked to the response: %q", rec.Body.String())
+	}
+}
+
+func TestForwardTo(t *testing.T) {
+	var query url.Values
+	cli, err := New(
+		WithClickBaseURL("https://binom.example/click.php"),
+		WithRetryPolicy(RetryPolicy{}),
+		WithTransport(TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+			query = req.URL.Query()
+			if query.Get("cnv_id") == "missing" {
+				return &TransportResponse{StatusCode: http.StatusOK, Body: []byte("click not found")}, nil
+			}
+			return &TransportResponse{StatusCode: http.StatusOK}, nil
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewPostbackHandler(ForwardTo(cli))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/postback?cnv_id=abc&payout=2&cnv_status=approved", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if query.Get("cnv_id") != "abc" || query.Get("payout") != "2" || query.Get("cnv_status") != "approved" {
+		t.Errorf("forwarded query = %v", query)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/postback?cnv_id=missing", nil))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("click not found: status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,253 @@
+package binomv2postback
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Call запрос клиента к трекеру, проходящий через цепочку перехватчиков.
+// Перехватчик может изменить аргументы запроса, отменить его, вернув ошибку,
+// или посмотреть на результат отправки.
+//
+// Params содержат секретные аргументы, например upd_key, в открытом виде:
+// они нужны для отправки. Для логов используйте RedactedQuery или String.
+type Call struct {
+	Kind    string   // вызов клиента: MetricsKindSendEvents, MetricsKindSendPostback или MetricsKindSendPostbackRequest
+	ClickID string   // clickID из вызова клиента
+	Params  []string // URL-аргументы "имя=значение" в порядке отправки, значения экранированы
+	Options SendClickOptions
+
+	sensitiveParams []string // аргументы, вырезаемые RedactedQuery, см. WithSensitiveParams
+}
+
+// Sender отправляет запрос к трекеру.
+type Sender func(call *Call) error
+
+// Interceptor оборачивает следующий Sender цепочки.
+//
+//	cli.Use(func(next Sender) Sender {
+//		return func(call *Call) error {
+//			if strings.HasPrefix(call.ClickID, "test") {
+//				return errors.New("test click")
+//			}
+//			return next(call)
+//		}
+//	})
+type Interceptor func(next Sender) Sender
+
+// IsConversion сообщает, создает ли запрос конверсию (cnv_id).
+func (c *Call) IsConversion() bool {
+	_, ok := c.Param("cnv_id")
+	return ok
+}
+
+// HasEvents сообщает, есть ли в запросе события eventX или add_eventX.
+func (c *Call) HasEvents() bool {
+	for _, p := range c.Params {
+		name, _, _ := strings.Cut(p, "=")
+		if strings.HasPrefix(strings.TrimPrefix(name, "add_"), "event") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Param возвращает значение аргумента name.
+func (c *Call) Param(name string) (string, bool) {
+	for _, p := range c.Params {
+		if k, v, _ := strings.Cut(p, "="); k == name {
+			value, err := url.QueryUnescape(v)
+			if err != nil {
+				return v, true
+			}
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// SetParam задает значение аргумента name, новый аргумент добавляется в конец.
+func (c *Call) SetParam(name, value string) {
+	param := name + "=" + url.QueryEscape(value)
+	for i, p := range c.Params {
+		if k, _, _ := strings.Cut(p, "="); k == name {
+			c.Params[i] = param
+			return
+		}
+	}
+	c.Params = append(c.Params, param)
+}
+
+// DelParam удаляет аргумент name.
+func (c *Call) DelParam(name string) {
+	params := c.Params[:0]
+	for _, p := range c.Params {
+		if k, _, _ := strings.Cut(p, "="); k != name {
+			params = append(params, p)
+		}
+	}
+	c.Params = params
+}
+
+// Query возвращает строку URL-аргументов запроса.
+func (c *Call) Query() string {
+	return strings.Join(c.Params, "&")
+}
+
+// RedactedQuery возвращает строку URL-аргументов без значений секретных аргументов
+// клиента (DefaultSensitiveParams, WithSensitiveParams).
+func (c *Call) RedactedQuery() string {
+	params := c.sensitiveParams
+	if params == nil {
+		params = DefaultSensitiveParams
+	}
+
+	return redactQuery(c.Query(), params)
+}
+
+// String возвращает вид вызова и RedactedQuery.
+func (c *Call) String() string {
+	return c.Kind + " " + c.RedactedQuery()
+}
+
+// callContext возвращает контекст из OptWithContext в opts или context.Background().
+func callContext(opts []sendClickOpt) context.Context {
+	return (&Call{Options: opts}).Context()
+}
+
+// Context возвращает контекст из OptWithContext или context.Background().
+func (c *Call) Context() context.Context {
+	clkReq := &clickReq{}
+	for _, f := range c.Options {
+		// ошибки опций проявятся при отправке
+		_ = f(nil, clkReq)
+	}
+	if clkReq.ctx == nil {
+		return context.Background()
+	}
+
+	return clkReq.ctx
+}
+
+// Use добавляет перехватчики вокруг отправки событий и postback запросов.
+// Перехватчики вызываются в порядке добавления. Снаружи цепочки стоят
+// встроенные метрики и логирование, внутри - проверка статуса конверсии
+// (WithStatusModel), пропуск пустых обновлений и режим dryRun, поэтому перехватчик может дополнить запрос до того,
+// как он будет выведен в dryRun, и отменить его до отправки.
+// Use не безопасен для вызова одновременно с отправкой.
+func (cli *client) Use(interceptors ...Interceptor) {
+	cli.interceptors = append(cli.interceptors, interceptors...)
+	cli.buildChain()
+}
+
+// WithInterceptors добавляет перехватчики при создании клиента, см. Client.Use.
+func WithInterceptors(interceptors ...Interceptor) ClientOption {
+	return func(cli *client) error {
+		for _, i := range interceptors {
+			if i == nil {
+				return errors.New("nil interceptor")
+			}
+		}
+		cli.Use(interceptors...)
+		return nil
+	}
+}
+
+// buildChain собирает цепочку: метрики, логирование, перехватчики Use,
+// запись выплаты, проверка статуса, пропуск пустых обновлений, dryRun и отправка sendCall.
+func (cli *client) buildChain() {
+	chain := []Interceptor{cli.metricsInterceptor, cli.logInterceptor}
+	chain = append(chain, cli.interceptors...)
+	chain = append(chain, cli.payoutInterceptor, cli.statusInterceptor, cli.skipEmptyInterceptor, cli.dryRunInterceptor)
+
+	sender := cli.sendCall
+	for i := len(chain) - 1; i >= 0; i-- {
+		sender = chain[i](sender)
+	}
+	cli.sender = sender
+}
+
+// send отправляет вызов через цепочку перехватчиков.
+// Внутри цепочки пропуск пустого обновления - ErrEmptyUpdate,
+// вызывающему он возвращается только с WithEmptyUpdateError.
+func (cli *client) send(call *Call) error {
+	call.sensitiveParams = cli.sensitiveParams
+	err := cli.sender(call)
+	if errors.Is(err, ErrEmptyUpdate) && !cli.emptyUpdateErr {
+		return nil
+	}
+
+	return err
+}
+
+// sendCall последнее звено цепочки: отправка запроса с повторами.
+func (cli *client) sendCall(call *Call) error {
+	return cli.sendClick(call.Kind, call.Query(), call.Options...)
+}
+
+// logInterceptor пишет в лог вызовы клиента и их ошибки.
+func (cli *client) logInterceptor(next Sender) Sender {
+	return func(call *Call) error {
+		if cli.log == nil {
+			return next(call)
+		}
+		cli.log.Debugf("%s for click %s: %s", call.Kind, call.ClickID, call.RedactedQuery())
+		err := next(call)
+		if err != nil && !errors.Is(err, ErrEmptyUpdate) {
+			cli.log.Errorf("%s for click %s failed: %v", call.Kind, call.ClickID, err)
+		}
+		return err
+	}
+}
+
+// skipEmptyInterceptor не отправляет обновления клика без событий, если это не конверсия.
+func (cli *client) skipEmptyInterceptor(next Sender) Sender {
+	return func(call *Call) error {
+		// не посылать пустые события !!!
+		if cli.dontSendEmptyUpdates && !call.IsConversion() && !call.HasEvents() {
+			if cli.log != nil {
+				cli.log.Debugf("%s>cli.dontSendEmptyUpdates: empty update", call.Kind)
+			}
+			if clkReq, err := cli.newClickReq(call.Options...); err == nil {
+				clkReq.setResponse(&Response{Result: ResultSkipped})
+			}
+			return ErrEmptyUpdate
+		}
+		return next(call)
+	}
+}
+
+// dryRunInterceptor в режиме dryRun выводит запрос вместо отправки.
+func (cli *client) dryRunInterceptor(next Sender) Sender {
+	return func(call *Call) error {
+		clkReq, err := cli.newClickReq(call.Options...)
+		if err != nil {
+			return err
+		}
+		if !clkReq.dryRun {
+			return next(call)
+		}
+		clkReq.kind = call.Kind
+		query := call.Query()
+		_, span := cli.startSpan(clkReq.ctx, SpanNameSend)
+		setSpanRequest(span, clkReq, query)
+
+		start := time.Now()
+		resp, err := cli.roundTrip(clkReq, query)
+		if err == nil {
+			clkReq.setResponse(&Response{Result: ResultDryRun})
+			if cli.metrics != nil {
+				cli.metrics.ObserveDryRun(call.Kind)
+			}
+		}
+		cli.logAttempt(clkReq, query, resp, err, time.Since(start), true)
+		span.End(err)
+
+		return err
+	}
+}
@@ -0,0 +1,186 @@
+package binomv2postback
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+// recordInterceptor записывает вход и выход из перехватчика name в order
+func recordInterceptor(mu *sync.Mutex, order *[]string, name string) Interceptor {
+	record := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		*order = append(*order, s)
+	}
+	return func(next Sender) Sender {
+		return func(call *Call) error {
+			record(name + ">" + call.Kind)
+			err := next(call)
+			record(name + "<")
+			return err
+		}
+	}
+}
+
+func TestInterceptorChainOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	var queries []url.Values
+	tr := TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, "send")
+		queries = append(queries, req.URL.Query())
+		return &TransportResponse{StatusCode: http.StatusOK}, nil
+	})
+	cli := newDedupTestClient(t, tr,
+		WithInterceptors(recordInterceptor(&mu, &order, "a")),
+		WithInterceptors(recordInterceptor(&mu, &order, "b")))
+	cli.Use(recordInterceptor(&mu, &order, "c"))
+
+	status := "approved"
+	calls := []struct {
+		kind string
+		send func() error
+	}{
+		{MetricsKindSendEvents, func() error { return cli.SendEvent("c1", binom.Event(1, 1)) }},
+		{MetricsKindSendPostback, func() error { return cli.SendPostback("c2", &status, nil, Events{}) }},
+		{MetricsKindSendPostbackRequest, func() error {
+			return cli.SendPostbackRequest(NewRequestBuilder().WithStatus(status).Request("c3"))
+		}},
+		// SendPostbackRequest без конверсии отправляется как обновление событий
+		{MetricsKindSendPostbackRequest, func() error {
+			return cli.SendPostbackRequest(NewRequestBuilder().WithEvents(mustEvents(t, binom.Event(2, 1))).Request("c4"))
+		}},
+	}
+	for _, c := range calls {
+		order = nil
+		if err := c.send(); err != nil {
+			t.Fatalf("%s: %v", c.kind, err)
+		}
+		want := "a>" + c.kind + " b>" + c.kind + " c>" + c.kind + " send c< b< a<"
+		if got := strings.Join(order, " "); got != want {
+			t.Errorf("%s: order = %s, want %s", c.kind, got, want)
+		}
+	}
+	if len(queries) != 4 || queries[0].Get("upd_clickid") != "c1" || queries[1].Get("cnv_id") != "c2" ||
+		queries[2].Get("cnv_id") != "c3" || queries[3].Get("upd_clickid") != "c4" {
+		t.Errorf("sent %v", queries)
+	}
+}
+
+func TestInterceptorModifiesAndCancels(t *testing.T) {
+	tr := &coalesceTracker{}
+	errTest := errors.New("test click")
+	metrics := &kindMetrics{}
+	log := &testLogger{}
+	cli := newDedupTestClient(t, tr, WithMetrics(metrics), WithLogger(log), WithUPDKey("secret"),
+		WithInterceptors(func(next Sender) Sender {
+			return func(call *Call) error {
+				if strings.HasPrefix(call.ClickID, "test") {
+					return errTest
+				}
+				call.SetParam("sub_id_1", "from interceptor")
+				call.DelParam("event2")
+				return next(call)
+			}
+		}))
+
+	status := "approved"
+	if err := cli.SendPostback("c1", &status, nil, mustEvents(t, binom.Event(1, 1), binom.Event(2, 1))); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.SendEvent("test1", binom.Event(1, 1)); !errors.Is(err, errTest) {
+		t.Errorf("canceled call: %v", err)
+	}
+	if err := cli.SendPostbackRequest(NewRequestBuilder().WithStatus(status).Request("test2")); !errors.Is(err, errTest) {
+		t.Errorf("canceled request: %v", err)
+	}
+
+	sent := tr.sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d requests, want 1", len(sent))
+	}
+	if q := sent[0]; q.Get("sub_id_1") != "from interceptor" || q.Has("event2") || q.Get("event1") != "1" {
+		t.Errorf("sent %v", q)
+	}
+	// метрики и лог стоят снаружи перехватчиков и видят отмененные вызовы
+	if len(metrics.kinds) != 3 {
+		t.Errorf("metrics kinds = %v", metrics.kinds)
+	}
+	if lines := log.find("failed: test click"); len(lines) != 2 {
+		t.Errorf("canceled calls log = %q", log.lines)
+	}
+	// попытки пишутся одной записью Debug в logAttempt
+	if lines := log.find("Binom request: GET"); len(lines) != 1 || !strings.HasPrefix(lines[0], "DEBUG ") {
+		t.Errorf("attempt log = %q", log.lines)
+	}
+	for _, line := range log.lines {
+		if strings.Contains(line, "secret") {
+			t.Errorf("upd_key in the log: %s", line)
+		}
+	}
+}
+
+func TestInterceptorBeforeStatusAndDryRun(t *testing.T) {
+	var out bytes.Buffer
+	var seen []error
+	cli := newDedupTestClient(t, &coalesceTracker{}, WithDryRun(true), WithDryRunWriter(&out),
+		WithStatusModel(DefaultStatusModel(), NewMemoryStatusStore()),
+		WithInterceptors(func(next Sender) Sender {
+			return func(call *Call) error {
+				call.SetParam("sub_id_1", "x")
+				err := next(call)
+				seen = append(seen, err)
+				return err
+			}
+		}))
+
+	status := "paid"
+	if err := cli.SendPostback("c1", &status, nil, Events{}); !errors.Is(err, ErrUnknownStatus) {
+		t.Fatalf("unknown status: %v", err)
+	}
+	status = "lead"
+	if err := cli.SendPostback("c1", &status, nil, Events{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || !errors.Is(seen[0], ErrUnknownStatus) || seen[1] != nil {
+		t.Errorf("interceptor results = %v", seen)
+	}
+	if !strings.Contains(out.String(), "sub_id_1=x") {
+		t.Errorf("dry run output = %q", out.String())
+	}
+}
+
+func TestCallRedactedQuery(t *testing.T) {
+	call := &Call{Kind: MetricsKindSendEvents, Params: []string{"upd_clickid=c1", "upd_key=secret", "event1=1"}}
+	if got := call.RedactedQuery(); got != "upd_clickid=c1&upd_key=REDACTED&event1=1" {
+		t.Errorf("RedactedQuery = %s", got)
+	}
+
+	var seen string
+	cli := newDedupTestClient(t, &coalesceTracker{}, WithUPDKey("secret"), WithSensitiveParams("sub_id_1"),
+		WithInterceptors(func(next Sender) Sender {
+			return func(call *Call) error {
+				call.SetParam("sub_id_1", "private")
+				seen = call.String()
+				if v, _ := call.Param("upd_key"); v != "secret" {
+					t.Errorf("Param(upd_key) = %q", v)
+				}
+				return next(call)
+			}
+		}))
+	if err := cli.SendEvent("c1", binom.Event(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(seen, MetricsKindSendEvents+" ") || strings.Contains(seen, "secret") || strings.Contains(seen, "private") {
+		t.Errorf("String = %s", seen)
+	}
+}
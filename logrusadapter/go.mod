@@ -0,0 +1,17 @@
+module github.com/CLi-Ter/binomv2-postback/logrusadapter
+
+go 1.21
+
+require (
+	github.com/CLi-Ter/binomv2-postback v0.0.0
+	github.com/sirupsen/logrus v1.9.3
+)
+
+require (
+	golang.org/x/sys v0.20.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// модуль собирается с клиентом из этого репозитория; при выпуске require
+// указывает выпущенную версию github.com/CLi-Ter/binomv2-postback
+replace github.com/CLi-Ter/binomv2-postback => ../
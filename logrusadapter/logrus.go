@@ -0,0 +1,108 @@
+// Package logrusadapter подключает logrus к клиенту Binom:
+// как Logger и как обработчик структурных записей log/slog (WithSlog).
+//
+//	l := logrus.New()
+//	cli, err := binomv2postback.New(
+//		binomv2postback.WithClickBaseURL(clickURL),
+//		binomv2postback.WithLogger(logrusadapter.NewLogger(l)),
+//		binomv2postback.WithSlog(slog.New(logrusadapter.NewHandler(l))),
+//	)
+//
+// Адаптер - отдельный модуль, чтобы клиент не зависел от logrus:
+//
+//	go get github.com/CLi-Ter/binomv2-postback/logrusadapter
+package logrusadapter
+
+import (
+	"context"
+	"log/slog"
+
+	binomv2postback "github.com/CLi-Ter/binomv2-postback"
+	"github.com/sirupsen/logrus"
+)
+
+// NewLogger возвращает Logger, пишущий в l (*logrus.Logger или *logrus.Entry).
+func NewLogger(l logrus.FieldLogger) binomv2postback.Logger {
+	return l
+}
+
+// Handler slog.Handler, пишущий записи в logrus с атрибутами как полями logrus.
+type Handler struct {
+	l      *logrus.Logger
+	fields logrus.Fields
+	prefix string // группа slog, добавляется к именам полей через точку
+}
+
+// NewHandler создает slog.Handler поверх l.
+func NewHandler(l *logrus.Logger) *Handler {
+	return &Handler{l: l, fields: logrus.Fields{}}
+}
+
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.l.IsLevelEnabled(logrusLevel(level))
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make(logrus.Fields, len(h.fields)+r.NumAttrs())
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(fields, h.prefix, a)
+		return true
+	})
+	h.l.WithContext(ctx).WithTime(r.Time).WithFields(fields).Log(logrusLevel(r.Level), r.Message)
+
+	return nil
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(logrus.Fields, len(h.fields)+len(attrs))
+	for k, v := range h.fields {
+		fields[k] = v
+	}
+	for _, a := range attrs {
+		addAttr(fields, h.prefix, a)
+	}
+
+	return &Handler{l: h.l, fields: fields, prefix: h.prefix}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return &Handler{l: h.l, fields: h.fields, prefix: h.prefix + name + "."}
+}
+
+func addAttr(fields logrus.Fields, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix = prefix + a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			addAttr(fields, groupPrefix, ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	fields[prefix+a.Key] = v.Any()
+}
+
+func logrusLevel(level slog.Level) logrus.Level {
+	switch {
+	case level >= slog.LevelError:
+		return logrus.ErrorLevel
+	case level >= slog.LevelWarn:
+		return logrus.WarnLevel
+	case level >= slog.LevelInfo:
+		return logrus.InfoLevel
+	}
+
+	return logrus.DebugLevel
+}
@@ -0,0 +1,265 @@
+package binomv2postback
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Виды вызовов клиента в метриках
+const (
+	MetricsKindSendEvents          = "SendEvents"
+	MetricsKindSendPostback        = "SendPostback"
+	MetricsKindSendPostbackRequest = "SendPostbackRequest"
+)
+
+// Результаты вызовов клиента в метриках
+const (
+	MetricsResultSuccess = "success" // трекер принял запрос (или запрос выведен в режиме dryRun)
+	MetricsResultError   = "error"   // запрос не доставлен или трекер ответил ошибкой
+	MetricsResultSkipped = "skipped" // пустое обновление событий не отправлялось
+)
+
+// Metrics получает события отправки запросов к трекеру.
+// Методы вызываются конкурентно из всех горутин, использующих клиент.
+type Metrics interface {
+	// ObserveRequest учитывает завершенный вызов kind (MetricsKind*) с результатом result (MetricsResult*).
+	ObserveRequest(kind, result string)
+	// ObserveLatency учитывает длительность одной попытки запроса к host.
+	ObserveLatency(host string, latency time.Duration)
+	// AddInFlight изменяет на delta число выполняемых запросов к host.
+	AddInFlight(host string, delta int)
+	// ObserveDryRun учитывает запрос kind, не отправленный в режиме dryRun.
+	ObserveDryRun(kind string)
+}
+
+// WithMetrics задает получателя метрик клиента, например PrometheusMetrics.
+func WithMetrics(m Metrics) ClientOption {
+	return func(cli *client) error {
+		if m == nil {
+			return errors.New("nil metrics")
+		}
+		cli.metrics = m
+		return nil
+	}
+}
+
+// metricsInterceptor учитывает результат каждого вызова клиента.
+func (cli *client) metricsInterceptor(next Sender) Sender {
+	return func(call *Call) error {
+		err := next(call)
+		if cli.metrics == nil {
+			return err
+		}
+		result := MetricsResultSuccess
+		switch {
+		case errors.Is(err, ErrEmptyUpdate):
+			result = MetricsResultSkipped
+		case err != nil:
+			result = MetricsResultError
+		}
+		cli.metrics.ObserveRequest(call.Kind, result)
+
+		return err
+	}
+}
+
+// DefaultLatencyBuckets границы гистограммы длительности запросов в секундах
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type latencyHistogram struct {
+	counts []uint64 // по одному счетчику на границу, не накопительно
+	count  uint64
+	sum    float64
+}
+
+type requestKey struct {
+	kind   string
+	result string
+}
+
+// PrometheusMetrics собирает метрики клиента в памяти процесса
+// и отдает их в текстовом формате Prometheus без внешних зависимостей:
+//
+//	metrics := NewPrometheusMetrics()
+//	cli, err := New(WithClickBaseURL(clickURL), WithMetrics(metrics))
+//	http.Handle("/metrics", metrics)
+type PrometheusMetrics struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	latency  map[string]*latencyHistogram
+	inFlight map[string]int64
+	dryRun   map[string]uint64
+}
+
+// NewPrometheusMetrics создает PrometheusMetrics с границами гистограммы
+// длительности buckets в секундах, по умолчанию DefaultLatencyBuckets.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &PrometheusMetrics{
+		buckets:  buckets,
+		requests: make(map[requestKey]uint64),
+		latency:  make(map[string]*latencyHistogram),
+		inFlight: make(map[string]int64),
+		dryRun:   make(map[string]uint64),
+	}
+}
+
+func (m *PrometheusMetrics) ObserveRequest(kind, result string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{kind: kind, result: result}]++
+}
+
+func (m *PrometheusMetrics) ObserveLatency(host string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h, ok := m.latency[host]
+	if !ok {
+		h = &latencyHistogram{counts: make([]uint64, len(m.buckets))}
+		m.latency[host] = h
+	}
+	seconds := latency.Seconds()
+	if i := sort.SearchFloat64s(m.buckets, seconds); i < len(m.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += seconds
+}
+
+func (m *PrometheusMetrics) AddInFlight(host string, delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inFlight[host] += int64(delta)
+}
+
+func (m *PrometheusMetrics) ObserveDryRun(kind string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dryRun[kind]++
+}
+
+// WriteTo пишет метрики в текстовом формате Prometheus.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	m.mu.Lock()
+	m.write(bw)
+	m.mu.Unlock()
+
+	err := bw.Flush()
+
+	return cw.n, err
+}
+
+func (m *PrometheusMetrics) write(w io.Writer) {
+	fmt.Fprintln(w, "# HELP binom_postback_requests_total Binom client calls by kind and result.")
+	fmt.Fprintln(w, "# TYPE binom_postback_requests_total counter")
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].kind != keys[j].kind {
+			return keys[i].kind < keys[j].kind
+		}
+		return keys[i].result < keys[j].result
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "binom_postback_requests_total{kind=%s,result=%s} %d\n",
+			quoteLabel(key.kind), quoteLabel(key.result), m.requests[key])
+	}
+
+	fmt.Fprintln(w, "# HELP binom_postback_request_duration_seconds Binom request attempt latency by host.")
+	fmt.Fprintln(w, "# TYPE binom_postback_request_duration_seconds histogram")
+	for _, host := range sortedKeys(m.latency) {
+		h := m.latency[host]
+		label := quoteLabel(host)
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "binom_postback_request_duration_seconds_bucket{host=%s,le=\"%s\"} %d\n",
+				label, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(w, "binom_postback_request_duration_seconds_bucket{host=%s,le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(w, "binom_postback_request_duration_seconds_sum{host=%s} %s\n", label, formatFloat(h.sum))
+		fmt.Fprintf(w, "binom_postback_request_duration_seconds_count{host=%s} %d\n", label, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP binom_postback_requests_in_flight Binom requests currently in flight by host.")
+	fmt.Fprintln(w, "# TYPE binom_postback_requests_in_flight gauge")
+	for _, host := range sortedKeys(m.inFlight) {
+		fmt.Fprintf(w, "binom_postback_requests_in_flight{host=%s} %d\n", quoteLabel(host), m.inFlight[host])
+	}
+
+	fmt.Fprintln(w, "# HELP binom_postback_dry_run_total Binom requests printed instead of sent in dry-run mode.")
+	fmt.Fprintln(w, "# TYPE binom_postback_dry_run_total counter")
+	for _, kind := range sortedKeys(m.dryRun) {
+		fmt.Fprintf(w, "binom_postback_dry_run_total{kind=%s} %d\n", quoteLabel(kind), m.dryRun[kind])
+	}
+}
+
+// ServeHTTP отдает метрики, PrometheusMetrics можно повесить на /metrics.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
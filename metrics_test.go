@@ -0,0 +1,139 @@
+package binomv2postback
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+func TestPrometheusMetricsExposition(t *testing.T) {
+	m := NewPrometheusMetrics(1, 0.1)
+	m.ObserveRequest(MetricsKindSendPostback, MetricsResultSuccess)
+	m.ObserveRequest(MetricsKindSendEvents, MetricsResultError)
+	m.ObserveRequest(MetricsKindSendEvents, MetricsResultError)
+	m.ObserveRequest(MetricsKindSendEvents, MetricsResultSkipped)
+	m.ObserveLatency("b.example", 50*time.Millisecond)
+	m.ObserveLatency("b.example", 100*time.Millisecond)
+	m.ObserveLatency("b.example", 500*time.Millisecond)
+	m.ObserveLatency("b.example", 2*time.Second)
+	m.ObserveLatency(`a"\`+"\n", time.Millisecond)
+	m.AddInFlight("b.example", 2)
+	m.AddInFlight("b.example", -1)
+	m.ObserveDryRun(MetricsKindSendEvents)
+
+	want := `# HELP binom_postback_requests_total Binom client calls by kind and result.
+# TYPE binom_postback_requests_total counter
+binom_postback_requests_total{kind="SendEvents",result="error"} 2
+binom_postback_requests_total{kind="SendEvents",result="skipped"} 1
+binom_postback_requests_total{kind="SendPostback",result="success"} 1
+# HELP binom_postback_request_duration_seconds Binom request attempt latency by host.
+# TYPE binom_postback_request_duration_seconds histogram
+binom_postback_request_duration_seconds_bucket{host="a\"\\\n",le="0.1"} 1
+binom_postback_request_duration_seconds_bucket{host="a\"\\\n",le="1"} 1
+binom_postback_request_duration_seconds_bucket{host="a\"\\\n",le="+Inf"} 1
+binom_postback_request_duration_seconds_sum{host="a\"\\\n"} 0.001
+binom_postback_request_duration_seconds_count{host="a\"\\\n"} 1
+binom_postback_request_duration_seconds_bucket{host="b.example",le="0.1"} 2
+binom_postback_request_duration_seconds_bucket{host="b.example",le="1"} 3
+binom_postback_request_duration_seconds_bucket{host="b.example",le="+Inf"} 4
+binom_postback_request_duration_seconds_sum{host="b.example"} 2.65
+binom_postback_request_duration_seconds_count{host="b.example"} 4
+# HELP binom_postback_requests_in_flight Binom requests currently in flight by host.
+# TYPE binom_postback_requests_in_flight gauge
+binom_postback_requests_in_flight{host="b.example"} 1
+# HELP binom_postback_dry_run_total Binom requests printed instead of sent in dry-run mode.
+# TYPE binom_postback_dry_run_total counter
+binom_postback_dry_run_total{kind="SendEvents"} 1
+`
+	var buf bytes.Buffer
+	n, err := m.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want {
+		t.Errorf("exposition:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo = %d, wrote %d bytes", n, buf.Len())
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %s", ct)
+	}
+	if rec.Body.String() != want {
+		t.Errorf("ServeHTTP body differs from WriteTo")
+	}
+}
+
+func TestPrometheusMetricsDefaultBuckets(t *testing.T) {
+	m := NewPrometheusMetrics()
+	m.ObserveLatency("h", 20*time.Millisecond)
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	out := buf.String()
+	if n := strings.Count(out, "_bucket{"); n != len(DefaultLatencyBuckets)+1 {
+		t.Errorf("%d buckets, want %d", n, len(DefaultLatencyBuckets)+1)
+	}
+	for _, line := range []string{`le="0.01"} 0`, `le="0.025"} 1`, `le="10"} 1`, `le="+Inf"} 1`} {
+		if !strings.Contains(out, line) {
+			t.Errorf("no %s in\n%s", line, out)
+		}
+	}
+	// граница бакета включается в бакет
+	m.ObserveLatency("h", 50*time.Millisecond)
+	buf.Reset()
+	m.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `le="0.05"} 2`) {
+		t.Errorf("latency on the bucket bound is not in the bucket:\n%s", buf.String())
+	}
+}
+
+func TestClientPrometheusMetrics(t *testing.T) {
+	m := NewPrometheusMetrics()
+	var inFlight string
+	tr := TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		var buf bytes.Buffer
+		m.WriteTo(&buf)
+		inFlight = buf.String()
+		if req.URL.Query().Get("upd_clickid") == "bad" {
+			return &TransportResponse{StatusCode: http.StatusBadRequest}, nil
+		}
+		return &TransportResponse{StatusCode: http.StatusOK}, nil
+	})
+	cli := newDedupTestClient(t, tr, WithMetrics(m))
+
+	status := "approved"
+	cli.SendPostback("c1", &status, nil, Events{})
+	cli.SendEvent("bad", binom.Event(1, 1))
+	cli.SendEvents("c1", Events{})
+	cli.SendEvent("c1", binom.Event(1, 1), OptDryRun())
+
+	if !strings.Contains(inFlight, `binom_postback_requests_in_flight{host="binom.example"} 1`) {
+		t.Errorf("in-flight gauge during a request:\n%s", inFlight)
+	}
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	out := buf.String()
+	for _, line := range []string{
+		`binom_postback_requests_total{kind="SendPostback",result="success"} 1`,
+		`binom_postback_requests_total{kind="SendEvents",result="error"} 1`,
+		`binom_postback_requests_total{kind="SendEvents",result="skipped"} 1`,
+		// запрос в режиме dryRun успешен и учитывается отдельно
+		`binom_postback_requests_total{kind="SendEvents",result="success"} 1`,
+		`binom_postback_dry_run_total{kind="SendEvents"} 1`,
+		`binom_postback_requests_in_flight{host="binom.example"} 0`,
+		// попытки dryRun и пропущенные обновления не попадают в гистограмму
+		`binom_postback_request_duration_seconds_count{host="binom.example"} 2`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("no %s in\n%s", line, out)
+		}
+	}
+}
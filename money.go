@@ -0,0 +1,270 @@
+package binomv2postback
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MaxMoneyScale наибольшее число знаков после запятой в Money
+const MaxMoneyScale = 8
+
+// ErrInvalidMoney сумма не является десятичным числом или не помещается в Money
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// Money денежная сумма с фиксированной точкой: units единиц по 10^-scale
+// в валюте currency. Нулевое значение - 0 без валюты.
+//
+// String возвращает каноническую запись для трекера: без экспоненты
+// и без незначащих нулей ("10", "10.5", "-0.01"), поэтому одна и та же
+// сумма всегда уходит в Binom одной строкой.
+type Money struct {
+	units    int64
+	scale    uint8
+	currency Currency
+}
+
+// NewMoney создает сумму units * 10^-scale, например NewMoney(1050, 2, "USD") - 10.50 USD.
+func NewMoney(units int64, scale int, currency Currency) (Money, error) {
+	if scale < 0 || scale > MaxMoneyScale {
+		return Money{}, fmt.Errorf("%w: scale %d. Max: %d", ErrInvalidMoney, scale, MaxMoneyScale)
+	}
+
+	return Money{units: units, scale: uint8(scale), currency: currency}, nil
+}
+
+// ParseMoney разбирает десятичную запись суммы ("10.50", "1e3").
+// Знаки после MaxMoneyScale округляются половиной от нуля.
+func ParseMoney(s string, currency Currency) (Money, error) {
+	s = strings.TrimSpace(s)
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || strings.Contains(s, "/") {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	m, err := moneyFromRat(r, currency)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", err, s)
+	}
+
+	return m, nil
+}
+
+// MoneyFromFloat переводит float64 в Money по кратчайшей десятичной записи числа,
+// т.е. 0.1 становится ровно 0.1.
+func MoneyFromFloat(f float64, currency Currency) (Money, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Money{}, fmt.Errorf("%w: %v", ErrInvalidMoney, f)
+	}
+
+	return ParseMoney(strconv.FormatFloat(f, 'g', -1, 64), currency)
+}
+
+// moneyFromRat подбирает наименьший scale, при котором r записывается точно,
+// иначе округляет r до MaxMoneyScale знаков (или меньше, если сумма не помещается в int64).
+func moneyFromRat(r *big.Rat, currency Currency) (Money, error) {
+	for scale := 0; scale <= MaxMoneyScale; scale++ {
+		x := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(scale)))
+		if !x.IsInt() {
+			continue
+		}
+		if !x.Num().IsInt64() {
+			return Money{}, ErrInvalidMoney
+		}
+		return Money{units: x.Num().Int64(), scale: uint8(scale), currency: currency}, nil
+	}
+	for scale := MaxMoneyScale; scale >= 0; scale-- {
+		units := roundRat(new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(scale))))
+		if units.IsInt64() {
+			return Money{units: units.Int64(), scale: uint8(scale), currency: currency}.trim(), nil
+		}
+	}
+
+	return Money{}, ErrInvalidMoney
+}
+
+// roundRat округляет r до целого половиной от нуля.
+func roundRat(r *big.Rat) *big.Int {
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	// |2*m| >= denom - остаток не меньше половины
+	if m.Abs(m).Lsh(m, 1).Cmp(r.Denom()) >= 0 {
+		if r.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+
+	return q
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// trim убирает незначащие нули: 10.50 (1050, 2) -> 10.5 (105, 1)
+func (m Money) trim() Money {
+	for m.scale > 0 && m.units%10 == 0 {
+		m.units /= 10
+		m.scale--
+	}
+
+	return m
+}
+
+// Units возвращает сумму в единицах 10^-Scale.
+func (m Money) Units() int64 {
+	return m.units
+}
+
+// Scale возвращает число знаков после запятой.
+func (m Money) Scale() int {
+	return int(m.scale)
+}
+
+// Currency возвращает валюту суммы, пусто если валюта не задана.
+func (m Money) Currency() Currency {
+	return m.currency
+}
+
+// WithCurrency возвращает ту же сумму в валюте currency.
+func (m Money) WithCurrency(currency Currency) Money {
+	m.currency = currency
+	return m
+}
+
+// IsZero сообщает, равна ли сумма нулю.
+func (m Money) IsZero() bool {
+	return m.units == 0
+}
+
+// Equal сравнивает суммы и валюты, число знаков после запятой не важно.
+func (m Money) Equal(other Money) bool {
+	a, b := m.trim(), other.trim()
+	return a.units == b.units && a.scale == b.scale && a.currency == b.currency
+}
+
+// Round округляет сумму до scale знаков после запятой половиной от нуля.
+func (m Money) Round(scale int) Money {
+	if scale < 0 {
+		scale = 0
+	}
+	if scale >= int(m.scale) {
+		return m
+	}
+	r := new(big.Rat).SetFrac(big.NewInt(m.units), pow10(int(m.scale)-scale))
+	m.units = roundRat(r).Int64()
+	m.scale = uint8(scale)
+
+	return m
+}
+
+// Float64 возвращает сумму как float64, только для вывода и расчетов без точности.
+func (m Money) Float64() float64 {
+	f, _ := m.rat().Float64()
+	return f
+}
+
+func (m Money) rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(m.units), pow10(int(m.scale)))
+}
+
+// mul умножает сумму на rate и переводит в валюту currency.
+func (m Money) mul(rate float64, currency Currency) (Money, error) {
+	if math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return Money{}, fmt.Errorf("%w: rate %v", ErrInvalidMoney, rate)
+	}
+
+	return moneyFromRat(new(big.Rat).Mul(m.rat(), new(big.Rat).SetFloat64(rate)), currency)
+}
+
+// String возвращает каноническую запись суммы без валюты.
+func (m Money) String() string {
+	m = m.trim()
+	s := strconv.FormatInt(m.units, 10)
+	if m.scale == 0 {
+		return s
+	}
+	sign := ""
+	if m.units < 0 {
+		sign, s = "-", s[1:]
+	}
+	if pad := int(m.scale) + 1 - len(s); pad > 0 {
+		s = strings.Repeat("0", pad) + s
+	}
+
+	return sign + s[:len(s)-int(m.scale)] + "." + s[len(s)-int(m.scale):]
+}
+
+// MarshalText записывает сумму в канонической записи, валюта не записывается.
+func (m Money) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText разбирает сумму, валюта не меняется.
+func (m *Money) UnmarshalText(text []byte) error {
+	parsed, err := ParseMoney(string(text), m.currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+
+	return nil
+}
+
+// MarshalJSON записывает сумму JSON-числом в канонической записи.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON принимает JSON-число или строку, число разбирается без перевода в float64.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	return m.UnmarshalText([]byte(s))
+}
+
+// WithPayoutPrecision округляет выплату каждого запроса до digits знаков после запятой
+// (по умолчанию MaxMoneyScale). Выплата всегда отправляется в канонической записи Money.
+func WithPayoutPrecision(digits int) ClientOption {
+	return func(cli *client) error {
+		if digits < 0 || digits > MaxMoneyScale {
+			return fmt.Errorf("payout precision must be between 0 and %d", MaxMoneyScale)
+		}
+		cli.payoutPrecision = digits
+		return nil
+	}
+}
+
+// payoutInterceptor приводит аргумент payout к канонической записи с точностью payoutPrecision
+// и не отправляет запрос с cnv_currency не из ISO 4217.
+func (cli *client) payoutInterceptor(next Sender) Sender {
+	return func(call *Call) error {
+		if value, ok := call.Param("cnv_currency"); ok {
+			currency, err := ParseCurrency(value)
+			if err != nil {
+				return &ParamError{Param: "cnv_currency", Value: value, Err: ErrUnknownCurrency}
+			}
+			call.SetParam("cnv_currency", string(currency))
+		}
+		value, ok := call.Param("payout")
+		if !ok {
+			return next(call)
+		}
+		payout, err := ParseMoney(value, "")
+		if err != nil {
+			return &ParamError{Param: "payout", Value: value, Err: err}
+		}
+		call.SetParam("payout", payout.Round(cli.payoutPrecision).String())
+
+		return next(call)
+	}
+}
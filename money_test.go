@@ -0,0 +1,170 @@
+package binomv2postback
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  string
+		units int64
+		scale int
+	}{
+		{"10", "10", 10, 0},
+		{"10.50", "10.5", 105, 1},
+		{" 0.01 ", "0.01", 1, 2},
+		{"-0.01", "-0.01", -1, 2},
+		{"-1.005", "-1.005", -1005, 3},
+		{"1e3", "1000", 1000, 0},
+		{"1.5e-3", "0.0015", 15, 4},
+		{"0.000000015", "0.00000002", 2, 8},    // округление половиной от нуля
+		{"-0.000000015", "-0.00000002", -2, 8}, // и для отрицательных сумм
+		{"0.000000004", "0", 0, 0},
+		{"123456789.12345678", "123456789.12345678", 12345678912345678, 8},
+	}
+	for _, tt := range tests {
+		m, err := ParseMoney(tt.in, "USD")
+		if err != nil {
+			t.Errorf("ParseMoney(%q): %v", tt.in, err)
+			continue
+		}
+		if got := m.String(); got != tt.want {
+			t.Errorf("ParseMoney(%q).String() = %q, want %q", tt.in, got, tt.want)
+		}
+		if m.Units() != tt.units || m.Scale() != tt.scale {
+			t.Errorf("ParseMoney(%q) = %d * 10^-%d, want %d * 10^-%d", tt.in, m.Units(), m.Scale(), tt.units, tt.scale)
+		}
+		if m.Currency() != "USD" {
+			t.Errorf("ParseMoney(%q).Currency() = %q", tt.in, m.Currency())
+		}
+	}
+}
+
+func TestParseMoneyInvalid(t *testing.T) {
+	for _, in := range []string{"", "abc", "1/2", "1,5", "1e30", "NaN"} {
+		if m, err := ParseMoney(in, ""); !errors.Is(err, ErrInvalidMoney) {
+			t.Errorf("ParseMoney(%q) = %s, %v, want ErrInvalidMoney", in, m, err)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		units int64
+		scale int
+		want  string
+	}{
+		{0, 0, "0"},
+		{0, 2, "0"},
+		{1050, 2, "10.5"},
+		{1000, 3, "1"},
+		{5, 3, "0.005"},
+		{-5, 3, "-0.005"},
+		{-1234, 2, "-12.34"},
+	}
+	for _, tt := range tests {
+		m, err := NewMoney(tt.units, tt.scale, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.String(); got != tt.want {
+			t.Errorf("NewMoney(%d, %d).String() = %q, want %q", tt.units, tt.scale, got, tt.want)
+		}
+	}
+
+	if _, err := NewMoney(1, MaxMoneyScale+1, ""); !errors.Is(err, ErrInvalidMoney) {
+		t.Errorf("NewMoney with scale %d: %v", MaxMoneyScale+1, err)
+	}
+}
+
+func TestMoneyFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{0.1, "0.1"},
+		{0.1 + 0.2, "0.3"},
+		{10.5, "10.5"},
+		{1e-9, "0"},
+		{-2.675, "-2.675"},
+	}
+	for _, tt := range tests {
+		m, err := MoneyFromFloat(tt.in, "")
+		if err != nil {
+			t.Errorf("MoneyFromFloat(%v): %v", tt.in, err)
+			continue
+		}
+		if got := m.String(); got != tt.want {
+			t.Errorf("MoneyFromFloat(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyRound(t *testing.T) {
+	tests := []struct {
+		in     string
+		digits int
+		want   string
+	}{
+		{"1.005", 2, "1.01"},
+		{"-1.005", 2, "-1.01"},
+		{"1.004", 2, "1"},
+		{"2.5", 0, "3"},
+		{"1.5", 4, "1.5"},
+		{"1.5", -1, "2"},
+	}
+	for _, tt := range tests {
+		m, err := ParseMoney(tt.in, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Round(tt.digits).String(); got != tt.want {
+			t.Errorf("ParseMoney(%q).Round(%d) = %q, want %q", tt.in, tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyEqual(t *testing.T) {
+	a, _ := NewMoney(1050, 2, "USD")
+	b, _ := NewMoney(105, 1, "USD")
+	if !a.Equal(b) {
+		t.Errorf("%s != %s", a, b)
+	}
+	if a.Equal(b.WithCurrency("EUR")) {
+		t.Errorf("%s USD == %s EUR", a, b)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var v struct {
+		Payout *Money `json:"payout"`
+	}
+	for _, in := range []string{`{"payout": 12.30}`, `{"payout": "12.30"}`} {
+		v.Payout = nil
+		if err := json.Unmarshal([]byte(in), &v); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", in, err)
+		}
+		if v.Payout == nil || v.Payout.String() != "12.3" {
+			t.Errorf("Unmarshal(%s) = %v", in, v.Payout)
+		}
+	}
+
+	// число не проходит через float64
+	if err := json.Unmarshal([]byte(`{"payout": 0.12345678}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Payout.Units() != 12345678 || v.Payout.Scale() != 8 {
+		t.Errorf("payout = %d * 10^-%d", v.Payout.Units(), v.Payout.Scale())
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"payout":0.12345678}` {
+		t.Errorf("Marshal = %s", out)
+	}
+}
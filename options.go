@@ -0,0 +1,239 @@
+package binomv2postback
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ClientOption настройка клиента при создании
+type ClientOption func(cli *client) error
+
+// New создает клиент Binom-трекера из опций. Адрес обработчика клика
+// (WithClickBaseURL) обязателен и проверяется сразу.
+//
+//	cli, err := New(
+//		WithClickBaseURL("https://binom.tracker/click"),
+//		WithUPDKey(updKey),
+//		WithTimeout(5*time.Second),
+//		WithRetryPolicy(DefaultRetryPolicy()),
+//	)
+func New(opts ...ClientOption) (Client, error) {
+	cli := newClient()
+	for _, f := range opts {
+		if f == nil {
+			return nil, errors.New("nil client option")
+		}
+		if err := f(cli); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateClickBaseURL(cli.clickBaseURL); err != nil {
+		return nil, err
+	}
+
+	return cli, nil
+}
+
+func newClient() *client {
+	cli := &client{
+		dontSendEmptyUpdates: true,
+		sensitiveParams:      DefaultSensitiveParams,
+		payoutPrecision:      MaxMoneyScale,
+
+		transport: NewHTTPTransport(nil),
+	}
+	cli.buildChain()
+
+	return cli
+}
+
+func validateClickBaseURL(clickBaseURL string) error {
+	if clickBaseURL == "" {
+		return errors.New("click base URL is required")
+	}
+	u, err := url.Parse(clickBaseURL)
+	if err != nil {
+		return fmt.Errorf("invalid click base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid click base URL %q: scheme must be http or https", clickBaseURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid click base URL %q: empty host", clickBaseURL)
+	}
+
+	return nil
+}
+
+// WithClickBaseURL задает адрес обработчика клика в трекере https://binom.tracker/click
+func WithClickBaseURL(clickBaseURL string) ClientOption {
+	return func(cli *client) error {
+		cli.clickBaseURL = clickBaseURL
+		return nil
+	}
+}
+
+// WithAPIKey задает API-ключ Binom, нужен для создания кликов.
+func WithAPIKey(apiKey string) ClientOption {
+	return func(cli *client) error {
+		cli.apiKey = apiKey
+		return nil
+	}
+}
+
+// WithUPDKey задает UPDKey из настроек Binom, пустой ключ не отправляется.
+func WithUPDKey(updKey string) ClientOption {
+	return func(cli *client) error {
+		cli.updKey = nil
+		if updKey != "" {
+			cli.updKey = &updKey
+		}
+		return nil
+	}
+}
+
+// WithLogger задает логгер клиента.
+func WithLogger(log Logger) ClientOption {
+	return func(cli *client) error {
+		cli.log = log
+		return nil
+	}
+}
+
+// WithDryRun включает режим, в котором запросы не отправляются в трекер.
+func WithDryRun(dryRun bool) ClientOption {
+	return func(cli *client) error {
+		cli.dryRun = dryRun
+		return nil
+	}
+}
+
+// WithEmptyUpdates разрешает отправлять обновления клика без событий.
+// По умолчанию такие обновления не отправляются: вызов возвращает nil,
+// пропуск виден в метриках (MetricsResultSkipped) и в OptWithResponse (ResultSkipped).
+func WithEmptyUpdates(send bool) ClientOption {
+	return func(cli *client) error {
+		cli.dontSendEmptyUpdates = !send
+		return nil
+	}
+}
+
+// WithEmptyUpdateError возвращает ErrEmptyUpdate для пропущенных пустых обновлений
+// вместо nil.
+func WithEmptyUpdateError(enabled bool) ClientOption {
+	return func(cli *client) error {
+		cli.emptyUpdateErr = enabled
+		return nil
+	}
+}
+
+// WithTimeout задает таймаут каждой попытки запроса к трекеру.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(cli *client) error {
+		if timeout < 0 {
+			return fmt.Errorf("negative timeout %s", timeout)
+		}
+		cli.timeout = timeout
+		return nil
+	}
+}
+
+// WithHostTimeout задает таймаут попытки запроса к хосту host,
+// отличный от общего WithTimeout.
+func WithHostTimeout(host string, timeout time.Duration) ClientOption {
+	return func(cli *client) error {
+		if timeout < 0 {
+			return fmt.Errorf("negative timeout %s for host %s", timeout, host)
+		}
+		if cli.hostTimeouts == nil {
+			cli.hostTimeouts = make(map[string]time.Duration)
+		}
+		cli.hostTimeouts[host] = timeout
+		return nil
+	}
+}
+
+// WithHeader добавляет заголовок ко всем запросам клиента.
+func WithHeader(name, value string) ClientOption {
+	return func(cli *client) error {
+		if cli.headers == nil {
+			cli.headers = make(http.Header)
+		}
+		cli.headers.Add(name, value)
+		return nil
+	}
+}
+
+// WithHeaders добавляет заголовки ко всем запросам клиента.
+func WithHeaders(headers http.Header) ClientOption {
+	return func(cli *client) error {
+		for name, values := range headers {
+			for _, value := range values {
+				if err := WithHeader(name, value)(cli); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// WithUserAgent задает User-Agent запросов клиента.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(cli *client) error {
+		if cli.headers == nil {
+			cli.headers = make(http.Header)
+		}
+		cli.headers.Set("User-Agent", userAgent)
+		return nil
+	}
+}
+
+// WithSensitiveParams добавляет аргументы URL, значения которых
+// вырезаются из логов, ошибок и вывода dryRun, к DefaultSensitiveParams.
+func WithSensitiveParams(params ...string) ClientOption {
+	return func(cli *client) error {
+		cli.sensitiveParams = append(append([]string(nil), cli.sensitiveParams...), params...)
+		return nil
+	}
+}
+
+// WithDryRunWriter задает, куда выводить запросы в режиме dryRun.
+// По умолчанию они пишутся в логгер клиента, а без логгера никуда не выводятся.
+func WithDryRunWriter(w io.Writer) ClientOption {
+	return func(cli *client) error {
+		cli.dryRunOut = w
+		return nil
+	}
+}
+
+// WithRetryPolicy задает политику повторов неудачных запросов.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(cli *client) error {
+		cli.retry = policy
+		return nil
+	}
+}
+
+// WithRateLimit ограничивает частоту запросов к каждому хосту трекера.
+func WithRateLimit(limit RateLimit) ClientOption {
+	return func(cli *client) error {
+		if limit.RequestsPerSecond <= 0 {
+			return fmt.Errorf("invalid rate limit %v requests per second", limit.RequestsPerSecond)
+		}
+		cli.limiter = NewRateLimiter(limit)
+		return nil
+	}
+}
+
+// WithRateLimiter задает общий для нескольких клиентов RateLimiter.
+func WithRateLimiter(limiter *RateLimiter) ClientOption {
+	return func(cli *client) error {
+		cli.limiter = limiter
+		return nil
+	}
+}
@@ -0,0 +1,121 @@
+package binomv2postback
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewOptions(t *testing.T) {
+	var out bytes.Buffer
+	limiter := NewRateLimiter(RateLimit{RequestsPerSecond: 1})
+	log := &testLogger{}
+	c, err := New(
+		WithClickBaseURL("https://binom.example/click.php"),
+		WithAPIKey("api"),
+		WithUPDKey("upd"),
+		WithLogger(log),
+		WithDryRun(true),
+		WithDryRunWriter(&out),
+		WithEmptyUpdates(true),
+		WithEmptyUpdateError(true),
+		WithTimeout(time.Second),
+		WithHostTimeout("slow.example", time.Minute),
+		WithHeader("X-A", "1"),
+		WithHeaders(http.Header{"X-A": {"2"}, "X-B": {"3"}}),
+		WithUserAgent("test"),
+		WithSensitiveParams("sub_id_1"),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2}),
+		WithRateLimiter(limiter),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := c.(*client)
+	if cli.apiKey != "api" || cli.updKey == nil || *cli.updKey != "upd" || cli.log != log {
+		t.Errorf("keys and logger: %q, %v, %v", cli.apiKey, cli.updKey, cli.log)
+	}
+	if !cli.dryRun || cli.dryRunOut != &out || cli.dontSendEmptyUpdates || !cli.emptyUpdateErr {
+		t.Errorf("flags: dryRun %v, dontSendEmptyUpdates %v, emptyUpdateErr %v", cli.dryRun, cli.dontSendEmptyUpdates, cli.emptyUpdateErr)
+	}
+	if cli.timeout != time.Second || cli.hostTimeouts["slow.example"] != time.Minute {
+		t.Errorf("timeouts: %s, %v", cli.timeout, cli.hostTimeouts)
+	}
+	if got := cli.headers.Values("X-A"); len(got) != 2 || cli.headers.Get("X-B") != "3" || cli.headers.Get("User-Agent") != "test" {
+		t.Errorf("headers: %v", cli.headers)
+	}
+	if len(cli.sensitiveParams) != len(DefaultSensitiveParams)+1 || len(DefaultSensitiveParams) != 2 {
+		t.Errorf("sensitive params: %v, defaults %v", cli.sensitiveParams, DefaultSensitiveParams)
+	}
+	if cli.retry.MaxAttempts != 2 || cli.limiter != limiter {
+		t.Errorf("retry %+v, limiter %p", cli.retry, cli.limiter)
+	}
+
+	// пустой UPDKey не отправляется
+	c, _ = New(WithClickBaseURL("https://binom.example/click.php"), WithUPDKey("upd"), WithUPDKey(""))
+	if c.(*client).updKey != nil {
+		t.Error("empty UPD key is set")
+	}
+}
+
+func TestNewOptionErrors(t *testing.T) {
+	base := WithClickBaseURL("https://binom.example/click.php")
+	for name, opt := range map[string]ClientOption{
+		"nil option":        nil,
+		"negative timeout":  WithTimeout(-1),
+		"host timeout":      WithHostTimeout("h", -time.Second),
+		"zero rate limit":   WithRateLimit(RateLimit{}),
+		"nil transport":     WithTransport(nil),
+		"nil http client":   WithHTTPClient(nil),
+		"nil round tripper": WithRoundTripper(nil),
+		"nil metrics":       WithMetrics(nil),
+		"nil tracer":        WithTracer(nil),
+		"nil interceptor":   WithInterceptors(nil),
+		"payout precision":  WithPayoutPrecision(MaxMoneyScale + 1),
+		"nil status model":  WithStatusModel(nil, NewMemoryStatusStore()),
+		"nil normalizer":    WithPayoutNormalizer(nil),
+		"nil registry":      WithEventRegistry(nil),
+	} {
+		if _, err := New(base, opt); err == nil {
+			t.Errorf("%s: New succeeded", name)
+		}
+	}
+	for _, clickBaseURL := range []string{"", "binom.example/click.php", "ftp://binom.example", "https://", "http://%zz"} {
+		if _, err := New(WithClickBaseURL(clickBaseURL)); err == nil {
+			t.Errorf("New accepted click base URL %q", clickBaseURL)
+		}
+	}
+}
+
+func TestNewClientIgnoresOptionErrors(t *testing.T) {
+	var slogOut bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&slogOut, nil)))
+	log := &testLogger{}
+
+	var c Client
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("NewClient panicked: %v", r)
+			}
+		}()
+		c = NewClient("https://binom.example/click.php", "api", "", WithTimeout(-1), nil, WithLogger(log), WithTransport(nil), WithTimeout(time.Second))
+	}()
+	cli := c.(*client)
+	if cli.timeout != time.Second || cli.transport == nil || cli.updKey != nil || cli.apiKey != "api" {
+		t.Errorf("client: timeout %s, transport %v, updKey %v", cli.timeout, cli.transport, cli.updKey)
+	}
+	if slogOut.Len() != 0 || len(log.lines) != 0 {
+		t.Errorf("NewClient logged option errors: %q, %q", slogOut.String(), log.lines)
+	}
+
+	// опции после ключей NewClient их заменяют
+	c = NewClient("", "", "upd", WithUPDKey("other"), WithDryRunWriter(io.Discard))
+	if cli := c.(*client); *cli.updKey != "other" || cli.clickBaseURL != "" {
+		t.Errorf("updKey %q, clickBaseURL %q", *cli.updKey, cli.clickBaseURL)
+	}
+}
@@ -0,0 +1,795 @@
+package binomv2postback
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	outboxOpEnqueue = "enqueue" // запрос поставлен в очередь
+	outboxOpAck     = "ack"     // запрос доставлен в трекер
+	outboxOpFail    = "fail"    // временная ошибка доставки, запрос будет повторен
+	outboxOpDead    = "dead"    // запрос не доставлен и отложен до Replay
+	outboxOpReplay  = "replay"  // отложенный запрос возвращен в очередь
+
+	outboxKindEvents   = "events"
+	outboxKindPostback = "postback"
+)
+
+// ErrOutboxClosed очередь закрыта и не принимает запросы
+var ErrOutboxClosed = errors.New("outbox closed")
+
+// ErrOutboxOption опцию запроса нельзя сохранить в журнале Outbox
+var ErrOutboxOption = errors.New("send option is not supported by outbox")
+
+// journalRetryDelay пауза диспетчера после ошибки записи журнала
+const journalRetryDelay = 5 * time.Second
+
+// outboxEntry строка журнала очереди
+type outboxEntry struct {
+	Op       string         `json:"op"`
+	ID       uint64         `json:"id"`
+	Kind     string         `json:"kind,omitempty"`
+	Request  *requestRecord `json:"request,omitempty"`
+	Options  *outboxOptions `json:"options,omitempty"`
+	Attempts int            `json:"attempts,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Time     time.Time      `json:"time"`
+}
+
+type outboxItem struct {
+	id          uint64
+	kind        string
+	req         requestRecord
+	opts        *outboxOptions
+	attempts    int
+	dead        bool
+	lastErr     string
+	nextAttempt time.Time
+	index       int // позиция в outboxQueue, -1 если запроса нет в очереди
+}
+
+// outboxQueue очередь запросов к отправке по времени следующей попытки
+// и порядку постановки (heap.Interface). Отложенных запросов в ней нет.
+type outboxQueue []*outboxItem
+
+func (q outboxQueue) Len() int { return len(q) }
+
+func (q outboxQueue) Less(i, j int) bool {
+	if !q[i].nextAttempt.Equal(q[j].nextAttempt) {
+		return q[i].nextAttempt.Before(q[j].nextAttempt)
+	}
+
+	return q[i].id < q[j].id
+}
+
+func (q outboxQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *outboxQueue) Push(x interface{}) {
+	item := x.(*outboxItem)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *outboxQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	item.index = -1
+	*q = old[:len(old)-1]
+
+	return item
+}
+
+// DefaultOutboxRetryPolicy возвращает политику доставки Outbox по умолчанию:
+// 20 попыток с задержкой от 10 секунд до часа, т.е. запрос откладывается
+// до Replay только после 12 с лишним часов недоступности трекера.
+func DefaultOutboxRetryPolicy() RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = 20
+	policy.BaseDelay = 10 * time.Second
+	policy.MaxDelay = time.Hour
+
+	return policy
+}
+
+// Outbox надежная очередь запросов к трекеру поверх Client.
+// Запросы сначала дописываются в журнал (JSONL файл) и сразу возвращают управление,
+// а фоновый диспетчер доставляет их в трекер с повторами (at-least-once).
+// Журнал переживает перезапуск процесса: недоставленные запросы
+// будут отправлены после следующего NewOutbox и Start.
+type Outbox struct {
+	cli          Client
+	path         string
+	log          Logger
+	retry        RetryPolicy
+	sendOpts     []sendClickOpt
+	compactEvery int
+
+	mu       sync.Mutex
+	file     *os.File
+	items    map[uint64]*outboxItem
+	queue    outboxQueue // запросы, ожидающие отправки
+	lastID   uint64
+	acked    int
+	dirty    bool // запись журнала не удалась, журнал нужно переписать
+	closed   bool
+	wake     chan struct{}
+	cancel   context.CancelFunc
+	finished chan struct{}
+}
+
+// OutboxOption настройка Outbox
+type OutboxOption func(o *Outbox)
+
+// OutboxWithLogger задает логгер диспетчера очереди.
+func OutboxWithLogger(log Logger) OutboxOption {
+	return func(o *Outbox) {
+		o.log = log
+	}
+}
+
+// OutboxWithRetryPolicy задает число попыток доставки и задержки между ними
+// (по умолчанию DefaultOutboxRetryPolicy). После исчерпания попыток запрос
+// откладывается до Replay. Повторы клиента при доставке отключены,
+// поэтому действует только эта политика.
+func OutboxWithRetryPolicy(policy RetryPolicy) OutboxOption {
+	return func(o *Outbox) {
+		o.retry = policy
+	}
+}
+
+// OutboxWithSendOptions задает опции, с которыми диспетчер отправляет запросы.
+// Опции повторов не действуют, см. OutboxWithRetryPolicy.
+func OutboxWithSendOptions(opts ...sendClickOpt) OutboxOption {
+	return func(o *Outbox) {
+		o.sendOpts = opts
+	}
+}
+
+// OutboxWithCompactEvery задает, после скольких доставленных запросов журнал сжимается.
+func OutboxWithCompactEvery(n int) OutboxOption {
+	return func(o *Outbox) {
+		o.compactEvery = n
+	}
+}
+
+// NewOutbox открывает (или создает) журнал очереди по пути path
+// и восстанавливает из него недоставленные запросы.
+func NewOutbox(cli Client, path string, opts ...OutboxOption) (*Outbox, error) {
+	o := &Outbox{
+		cli:          cli,
+		path:         path,
+		retry:        DefaultOutboxRetryPolicy(),
+		compactEvery: 1000,
+		items:        make(map[uint64]*outboxItem),
+		wake:         make(chan struct{}, 1),
+	}
+	for _, f := range opts {
+		f(o)
+	}
+
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	// убираем из журнала доставленные до перезапуска запросы
+	if err := o.compact(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// load восстанавливает состояние очереди из журнала.
+func (o *Outbox) load() error {
+	f, err := os.Open(o.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry outboxEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// недописанная при падении строка
+			if o.log != nil {
+				o.log.Errorf("outbox %s: skip broken line %d: %v", o.path, line, err)
+			}
+			continue
+		}
+		o.apply(entry)
+	}
+
+	return scanner.Err()
+}
+
+// apply применяет запись журнала к состоянию очереди.
+func (o *Outbox) apply(entry outboxEntry) {
+	if entry.ID > o.lastID {
+		o.lastID = entry.ID
+	}
+	if entry.Op == outboxOpEnqueue {
+		if entry.Request != nil {
+			item := &outboxItem{id: entry.ID, kind: entry.Kind, req: *entry.Request, opts: entry.Options}
+			o.items[entry.ID] = item
+			heap.Push(&o.queue, item)
+		}
+		return
+	}
+
+	item, ok := o.items[entry.ID]
+	if !ok {
+		return
+	}
+	switch entry.Op {
+	case outboxOpAck:
+		delete(o.items, entry.ID)
+		o.unqueue(item)
+	case outboxOpFail:
+		item.attempts = entry.Attempts
+		item.lastErr = entry.Error
+	case outboxOpDead:
+		item.attempts = entry.Attempts
+		item.lastErr = entry.Error
+		item.dead = true
+		o.unqueue(item)
+	case outboxOpReplay:
+		item.attempts = 0
+		item.dead = false
+		item.nextAttempt = time.Time{}
+		if item.index < 0 {
+			heap.Push(&o.queue, item)
+		} else {
+			heap.Fix(&o.queue, item.index)
+		}
+	}
+}
+
+// unqueue убирает запрос из очереди отправки. Вызывается под mu.
+func (o *Outbox) unqueue(item *outboxItem) {
+	if item.index >= 0 {
+		heap.Remove(&o.queue, item.index)
+	}
+}
+
+// write дописывает записи в журнал и сбрасывает их на диск. Вызывается под mu.
+func (o *Outbox) write(entries ...outboxEntry) error {
+	if o.file == nil {
+		f, err := os.OpenFile(o.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		o.file = f
+	}
+
+	var buf []byte
+	for _, entry := range entries {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, b...), '\n')
+	}
+	if _, err := o.file.Write(buf); err != nil {
+		return err
+	}
+
+	return o.file.Sync()
+}
+
+// outboxOptions опции запроса, которые сохраняются в журнале вместе с ним
+type outboxOptions struct {
+	ClickBaseURL   string `json:"click_base_url,omitempty"`
+	Host           string `json:"host,omitempty"`
+	DryRun         *bool  `json:"dry_run,omitempty"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// outboxProbeURL адрес, по изменению которого видно действие OptWithClickBaseURL и OptWithHost
+const outboxProbeURL = "http://outbox.invalid/outbox-probe"
+
+// newOutboxOptions сохраняет опции адреса, dryRun и ключа идемпотентности.
+// OptWithContext относится только к постановке в очередь и не сохраняется,
+// опции повторов и OptWithResponse не могут действовать при отложенной отправке.
+func newOutboxOptions(opts []sendClickOpt) (*outboxOptions, error) {
+	if len(opts) == 0 {
+		return nil, nil
+	}
+	// два пробных запроса с разным dryRun: если он совпал, его задала опция
+	probes := [2]*clickReq{
+		{clickBaseURL: outboxProbeURL, retry: RetryPolicy{MaxAttempts: -1}},
+		{clickBaseURL: outboxProbeURL, retry: RetryPolicy{MaxAttempts: -1}, dryRun: true},
+	}
+	for _, probe := range probes {
+		for _, f := range opts {
+			if err := f(nil, probe); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	probe := probes[0]
+	if probe.retry.MaxAttempts != -1 {
+		return nil, fmt.Errorf("%w: retry policy, use OutboxWithRetryPolicy", ErrOutboxOption)
+	}
+	if probe.response != nil {
+		return nil, fmt.Errorf("%w: OptWithResponse", ErrOutboxOption)
+	}
+	out := &outboxOptions{IdempotencyKey: probe.idempotencyKey}
+	if probe.dryRun == probes[1].dryRun {
+		dryRun := probe.dryRun
+		out.DryRun = &dryRun
+	}
+	if probe.clickBaseURL != outboxProbeURL {
+		u, err := url.Parse(probe.clickBaseURL)
+		if err != nil {
+			return nil, err
+		}
+		// OptWithHost меняет только хост, OptWithClickBaseURL - весь адрес
+		host := u.Host
+		u.Host = "outbox.invalid"
+		if u.String() == outboxProbeURL {
+			out.Host = host
+		} else {
+			out.ClickBaseURL = probe.clickBaseURL
+		}
+	}
+	if *out == (outboxOptions{}) {
+		return nil, nil
+	}
+
+	return out, nil
+}
+
+// sendOpts восстанавливает сохраненные опции запроса.
+func (opts *outboxOptions) sendOpts() []sendClickOpt {
+	if opts == nil {
+		return nil
+	}
+	var out []sendClickOpt
+	if opts.ClickBaseURL != "" {
+		out = append(out, OptWithClickBaseURL(opts.ClickBaseURL))
+	}
+	if opts.Host != "" {
+		out = append(out, OptWithHost(opts.Host))
+	}
+	if opts.DryRun != nil {
+		out = append(out, OptWithDryRun(*opts.DryRun))
+	}
+	if opts.IdempotencyKey != "" {
+		out = append(out, OptWithIdempotencyKey(opts.IdempotencyKey))
+	}
+
+	return out
+}
+
+// SendEvents ставит в очередь обновление клика событиями.
+// Опции адреса, dryRun и OptWithIdempotencyKey сохраняются вместе с запросом,
+// опции повторов и OptWithResponse возвращают ErrOutboxOption.
+func (o *Outbox) SendEvents(clickID string, events Events, opts ...sendClickOpt) error {
+	return o.enqueue(outboxKindEvents, requestRecord{ClickID: clickID, Events: newEventRecords(events)}, opts)
+}
+
+// SendPostbackRequest ставит в очередь postback запрос, опции как у SendEvents.
+func (o *Outbox) SendPostbackRequest(postback Request, opts ...sendClickOpt) error {
+	return o.enqueue(outboxKindPostback, newRequestRecord(postback), opts)
+}
+
+// SendPostback ставит в очередь конверсию, см. Client.SendPostback. Опции как у SendEvents.
+func (o *Outbox) SendPostback(clickID string, status *string, payout *Money, events Events, opts ...sendClickOpt) error {
+	req := &request{
+		clickID:   clickID,
+		cnvStatus: status,
+		events:    events,
+		isCnv:     true,
+	}
+	if payout != nil {
+		req.setPayout(*payout)
+	}
+
+	return o.SendPostbackRequest(req, opts...)
+}
+
+// AddNamedEvent ставит в очередь добавление val к событию name
+// из реестра событий клиента, см. Client.AddNamedEvent.
+func (o *Outbox) AddNamedEvent(clickID string, name string, val int64, opts ...sendClickOpt) error {
+	ev, err := o.eventRegistry().AddEvent(name, val)
+	if err != nil {
+		return err
+	}
+
+	return o.sendEvent(clickID, ev, opts)
+}
+
+// SetNamedEvent ставит в очередь установку события name в val, см. Client.SetNamedEvent.
+func (o *Outbox) SetNamedEvent(clickID string, name string, val int64, opts ...sendClickOpt) error {
+	ev, err := o.eventRegistry().Event(name, val)
+	if err != nil {
+		return err
+	}
+
+	return o.sendEvent(clickID, ev, opts)
+}
+
+func (o *Outbox) sendEvent(clickID string, ev Event, opts []sendClickOpt) error {
+	events := Events{}
+	if err := events.Set(ev, false); err != nil {
+		return err
+	}
+
+	return o.SendEvents(clickID, events, opts...)
+}
+
+func (o *Outbox) eventRegistry() *EventRegistry {
+	return eventRegistryOf(o.cli)
+}
+
+func (o *Outbox) enqueue(kind string, rec requestRecord, opts []sendClickOpt) error {
+	saved, err := newOutboxOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		return ErrOutboxClosed
+	}
+	entry := outboxEntry{Op: outboxOpEnqueue, ID: o.lastID + 1, Kind: kind, Request: &rec, Options: saved, Time: time.Now()}
+	if err := o.write(entry); err != nil {
+		return err
+	}
+	o.apply(entry)
+	o.notify()
+
+	return nil
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pending возвращает число запросов, ожидающих доставки.
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := 0
+	for _, item := range o.items {
+		if !item.dead {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Failed возвращает число запросов, отложенных после исчерпания попыток.
+func (o *Outbox) Failed() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := 0
+	for _, item := range o.items {
+		if item.dead {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Replay возвращает все отложенные запросы в очередь со сброшенным счетчиком попыток.
+// Возвращает число возвращенных запросов.
+func (o *Outbox) Replay() (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var entries []outboxEntry
+	for _, item := range o.sorted() {
+		if item.dead {
+			entries = append(entries, outboxEntry{Op: outboxOpReplay, ID: item.id, Time: time.Now()})
+		}
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	if err := o.write(entries...); err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		o.apply(entry)
+	}
+	o.notify()
+
+	return len(entries), nil
+}
+
+// Start запускает фоновый диспетчер. Диспетчер работает до Close или отмены ctx.
+func (o *Outbox) Start(ctx context.Context) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.cancel != nil || o.closed {
+		return
+	}
+	ctx, o.cancel = context.WithCancel(ctx)
+	o.finished = make(chan struct{})
+	go func() {
+		defer close(o.finished)
+		o.run(ctx)
+	}()
+}
+
+// Close останавливает диспетчер, сжимает и закрывает журнал.
+// Недоставленные запросы остаются в журнале.
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return nil
+	}
+	o.closed = true
+	cancel, finished := o.cancel, o.finished
+	o.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-finished
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.compact(); err != nil {
+		return err
+	}
+	if o.file != nil {
+		err := o.file.Close()
+		o.file = nil
+		return err
+	}
+
+	return nil
+}
+
+// Compact переписывает журнал, оставляя в нем только недоставленные запросы.
+func (o *Outbox) Compact() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.compact()
+}
+
+func (o *Outbox) compact() error {
+	var entries []outboxEntry
+	for _, item := range o.sorted() {
+		req := item.req
+		entries = append(entries, outboxEntry{Op: outboxOpEnqueue, ID: item.id, Kind: item.kind, Request: &req, Options: item.opts, Time: time.Now()})
+		switch {
+		case item.dead:
+			entries = append(entries, outboxEntry{Op: outboxOpDead, ID: item.id, Attempts: item.attempts, Error: item.lastErr, Time: time.Now()})
+		case item.attempts > 0:
+			entries = append(entries, outboxEntry{Op: outboxOpFail, ID: item.id, Attempts: item.attempts, Error: item.lastErr, Time: time.Now()})
+		}
+	}
+
+	tmp := o.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if o.file != nil {
+		o.file.Close()
+		o.file = nil
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return err
+	}
+	o.acked = 0
+	o.dirty = false
+
+	return nil
+}
+
+// retryHint возвращает ответ трекера из ошибки отправки, чтобы задержка
+// следующей попытки учла его Retry-After.
+func retryHint(err error) *clickResp {
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		return nil
+	}
+
+	return &clickResp{StatusCode: statusErr.StatusCode, Header: statusErr.Header}
+}
+
+// sorted возвращает запросы очереди в порядке постановки. Вызывается под mu.
+func (o *Outbox) sorted() []*outboxItem {
+	items := make([]*outboxItem, 0, len(o.items))
+	for _, item := range o.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].id < items[j].id
+	})
+
+	return items
+}
+
+// next возвращает первый готовый к отправке запрос
+// или время, когда стоит проверить очередь снова (-1, если очередь пуста).
+func (o *Outbox) next() (*outboxItem, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.queue) == 0 {
+		return nil, -1
+	}
+	item := o.queue[0]
+	if wait := time.Until(item.nextAttempt); wait > 0 {
+		return nil, wait
+	}
+
+	return item, 0
+}
+
+func (o *Outbox) run(ctx context.Context) {
+	for {
+		item, wait := o.next()
+		if item == nil {
+			var timer *time.Timer
+			var fire <-chan time.Time
+			if wait >= 0 {
+				timer = time.NewTimer(wait)
+				fire = timer.C
+			}
+			select {
+			case <-ctx.Done():
+			case <-o.wake:
+			case <-fire:
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		err := o.deliver(ctx, item)
+		if ctx.Err() != nil {
+			// остановка диспетчера, запрос будет отправлен после перезапуска
+			return
+		}
+		if err := o.record(item, err); err != nil {
+			if o.log != nil {
+				o.log.Errorf("outbox %s: failed to write journal: %v", o.path, err)
+			}
+			// не крутим цикл, пока журнал недоступен (например, нет места на диске)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(journalRetryDelay):
+			}
+		}
+	}
+}
+
+// deliver делает одну попытку доставки: повторы клиента отключены,
+// их заменяют попытки Outbox по его политике.
+func (o *Outbox) deliver(ctx context.Context, item *outboxItem) error {
+	opts := append([]sendClickOpt{OptWithContext(ctx)}, o.sendOpts...)
+	opts = append(opts, item.opts.sendOpts()...)
+	opts = append(opts, OptNoRetry())
+
+	switch item.kind {
+	case outboxKindEvents:
+		events, err := eventsFromRecords(item.req.Events)
+		if err != nil {
+			return err
+		}
+		return o.cli.SendEvents(item.req.ClickID, events, opts...)
+	case outboxKindPostback:
+		req, err := item.req.request()
+		if err != nil {
+			return err
+		}
+		return o.cli.SendPostbackRequest(req, opts...)
+	}
+
+	return fmt.Errorf("unknown outbox entry kind %q", item.kind)
+}
+
+// record записывает в журнал результат попытки доставки.
+// Пустое обновление и подавленный DedupClient повтор считаются доставленными.
+func (o *Outbox) record(item *outboxItem, sendErr error) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entry := outboxEntry{ID: item.id, Time: time.Now()}
+	switch {
+	case sendErr == nil || errors.Is(sendErr, ErrEmptyUpdate) || errors.Is(sendErr, ErrDuplicate):
+		entry.Op = outboxOpAck
+	case IsRetryable(sendErr) && item.attempts+1 < o.retry.attempts():
+		entry.Op = outboxOpFail
+		entry.Attempts = item.attempts + 1
+		entry.Error = sendErr.Error()
+	default:
+		entry.Op = outboxOpDead
+		entry.Attempts = item.attempts + 1
+		entry.Error = sendErr.Error()
+	}
+
+	if o.log != nil {
+		switch entry.Op {
+		case outboxOpFail:
+			o.log.Infof("outbox: request %d attempt %d failed: %v", item.id, entry.Attempts, sendErr)
+		case outboxOpDead:
+			o.log.Errorf("outbox: request %d moved to dead letters after %d attempts: %v", item.id, entry.Attempts, sendErr)
+		}
+	}
+
+	// результат попытки применяется и при ошибке записи журнала: доставленный запрос
+	// не отправляется повторно, а журнал переписывается при следующем сжатии
+	// (до него после перезапуска запрос может быть доставлен еще раз)
+	writeErr := o.write(entry)
+	o.apply(entry)
+	if entry.Op == outboxOpFail {
+		item.nextAttempt = time.Now().Add(o.retry.delay(entry.Attempts, retryHint(sendErr)))
+		heap.Fix(&o.queue, item.index)
+	}
+	if writeErr != nil {
+		o.dirty = true
+		return writeErr
+	}
+	if entry.Op == outboxOpAck {
+		o.acked++
+	}
+	if o.dirty || (o.compactEvery > 0 && o.acked >= o.compactEvery) {
+		return o.compact()
+	}
+
+	return nil
+}
@@ -0,0 +1,276 @@
+package binomv2postback
+
+import (
+	"container/heap"
+	"context"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+// outboxTracker запоминает запросы к трекеру и отвечает 500 на клики из failing
+// (503 с заголовком Retry-After, если он задан)
+type outboxTracker struct {
+	mu         sync.Mutex
+	requests   []*http.Request
+	failing    map[string]bool
+	retryAfter string
+}
+
+func (tr *outboxTracker) Send(req *TransportRequest) (*TransportResponse, error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.requests = append(tr.requests, req.Request)
+	q := req.URL.Query()
+	if tr.failing[q.Get("cnv_id")+q.Get("upd_clickid")] {
+		if tr.retryAfter != "" {
+			return &TransportResponse{StatusCode: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {tr.retryAfter}}}, nil
+		}
+		return &TransportResponse{StatusCode: http.StatusInternalServerError}, nil
+	}
+
+	return &TransportResponse{StatusCode: http.StatusOK}, nil
+}
+
+func (tr *outboxTracker) sent() []*http.Request {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return append([]*http.Request(nil), tr.requests...)
+}
+
+// newOutboxTestClient создает клиент с политикой повторов по умолчанию:
+// Outbox должен отключать повторы клиента
+func newOutboxTestClient(t *testing.T, tr *outboxTracker) Client {
+	t.Helper()
+	cli, err := New(WithClickBaseURL("https://binom.example/click.php"), WithTransport(tr))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cli
+}
+
+func waitOutbox(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for outbox")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestOutboxReplayAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	tr := &outboxTracker{}
+
+	// запросы ставятся в очередь, но диспетчер не запускается
+	ob, err := NewOutbox(newOutboxTestClient(t, tr), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := NewEvents(binom.Event(1, 2), binom.AddEvent(3, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ob.SendEvents("click-1", events, OptWithHost("other.example")); err != nil {
+		t.Fatal(err)
+	}
+	status := "approved"
+	payout, _ := ParseMoney("10.5", "EUR")
+	if err := ob.SendPostback("click-2", &status, &payout, Events{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ob.SendEvents("click-3", events, OptWithResponse(&Response{})); err == nil {
+		t.Error("OptWithResponse accepted by outbox")
+	}
+	if n := ob.Pending(); n != 2 {
+		t.Fatalf("pending = %d, want 2", n)
+	}
+	if err := ob.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// после перезапуска запросы отправляются с сохраненными опциями
+	ob, err = NewOutbox(newOutboxTestClient(t, tr), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := ob.Pending(); n != 2 {
+		t.Fatalf("pending after restart = %d, want 2", n)
+	}
+	ob.Start(context.Background())
+	waitOutbox(t, func() bool { return ob.Pending() == 0 })
+	if err := ob.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := tr.sent()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(sent))
+	}
+	q := sent[0].URL.Query()
+	if sent[0].URL.Host != "other.example" || q.Get("upd_clickid") != "click-1" || q.Get("event1") != "2" || q.Get("add_event3") != "1" {
+		t.Errorf("first request = %s", sent[0].URL)
+	}
+	q = sent[1].URL.Query()
+	if sent[1].URL.Host != "binom.example" || q.Get("cnv_id") != "click-2" || q.Get("cnv_status") != "approved" ||
+		q.Get("payout") != "10.5" || q.Get("cnv_currency") != "EUR" {
+		t.Errorf("second request = %s", sent[1].URL)
+	}
+
+	// доставленные запросы не отправляются после следующего перезапуска
+	ob, err = NewOutbox(newOutboxTestClient(t, tr), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Close()
+	if n := ob.Pending() + ob.Failed(); n != 0 {
+		t.Errorf("%d requests left after delivery", n)
+	}
+}
+
+func TestOutboxDeadLettersSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	tr := &outboxTracker{failing: map[string]bool{"click-1": true}}
+	policy := OutboxWithRetryPolicy(RetryPolicy{MaxAttempts: 2, RetryableStatusCodes: []int{http.StatusInternalServerError}})
+
+	ob, err := NewOutbox(newOutboxTestClient(t, tr), path, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ob.Start(context.Background())
+	events, _ := NewEvents(binom.Event(1, 1))
+	if err := ob.SendEvents("click-1", events); err != nil {
+		t.Fatal(err)
+	}
+	waitOutbox(t, func() bool { return ob.Failed() == 1 })
+	if err := ob.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// по одному запросу на попытку Outbox, без повторов клиента
+	if n := len(tr.sent()); n != 2 {
+		t.Errorf("sent %d attempts, want 2", n)
+	}
+
+	tr.mu.Lock()
+	tr.failing = nil
+	tr.mu.Unlock()
+
+	ob, err = NewOutbox(newOutboxTestClient(t, tr), path, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Close()
+	if ob.Failed() != 1 || ob.Pending() != 0 {
+		t.Fatalf("after restart failed = %d, pending = %d", ob.Failed(), ob.Pending())
+	}
+	ob.Start(context.Background())
+	if n, err := ob.Replay(); err != nil || n != 1 {
+		t.Fatalf("Replay = %d, %v", n, err)
+	}
+	waitOutbox(t, func() bool { return ob.Pending() == 0 && ob.Failed() == 0 })
+	if n := len(tr.sent()); n != 3 {
+		t.Errorf("sent %d requests, want 3", n)
+	}
+}
+
+func TestOutboxRetryAfter(t *testing.T) {
+	tr := &outboxTracker{failing: map[string]bool{"click-1": true}, retryAfter: "120"}
+	ob, err := NewOutbox(newOutboxTestClient(t, tr), filepath.Join(t.TempDir(), "outbox.jsonl"),
+		OutboxWithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Close()
+	ob.Start(context.Background())
+	events, _ := NewEvents(binom.Event(1, 1))
+	if err := ob.SendEvents("click-1", events); err != nil {
+		t.Fatal(err)
+	}
+
+	var next time.Time
+	waitOutbox(t, func() bool {
+		ob.mu.Lock()
+		defer ob.mu.Unlock()
+		for _, item := range ob.items {
+			if item.attempts == 1 {
+				next = item.nextAttempt
+				return true
+			}
+		}
+		return false
+	})
+	if wait := time.Until(next); wait < 110*time.Second || wait > 120*time.Second {
+		t.Errorf("next attempt in %s, want Retry-After 120s", wait)
+	}
+	if n := len(tr.sent()); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
+
+func TestOutboxDuplicateIsDelivered(t *testing.T) {
+	tr := &outboxTracker{}
+	cli := NewDedupClient(newOutboxTestClient(t, tr), NewMemoryDedupStore(0), time.Hour)
+	status := "approved"
+	if err := cli.SendPostback("click-1", &status, nil, Events{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ob, err := NewOutbox(cli, filepath.Join(t.TempDir(), "outbox.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Close()
+	ob.Start(context.Background())
+	if err := ob.SendPostback("click-1", &status, nil, Events{}); err != nil {
+		t.Fatal(err)
+	}
+	waitOutbox(t, func() bool { return ob.Pending() == 0 })
+	if n := ob.Failed(); n != 0 {
+		t.Errorf("duplicate moved to dead letters: failed = %d", n)
+	}
+	if n := len(tr.sent()); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
+
+func TestOutboxQueueOrder(t *testing.T) {
+	ob, err := NewOutbox(nil, filepath.Join(t.TempDir(), "outbox.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Close()
+	for id := uint64(1); id <= 4; id++ {
+		ob.apply(outboxEntry{Op: outboxOpEnqueue, ID: id, Kind: outboxKindEvents, Request: &requestRecord{ClickID: "c"}})
+	}
+
+	// 1 ждет повтора, 2 отложен, 3 и 4 готовы к отправке в порядке постановки
+	ob.items[1].nextAttempt = time.Now().Add(time.Hour)
+	ob.apply(outboxEntry{Op: outboxOpFail, ID: 1, Attempts: 1})
+	heap.Fix(&ob.queue, ob.items[1].index)
+	ob.apply(outboxEntry{Op: outboxOpDead, ID: 2, Attempts: 1})
+
+	for _, want := range []uint64{3, 4} {
+		item, _ := ob.next()
+		if item == nil || item.id != want {
+			t.Fatalf("next = %+v, want %d", item, want)
+		}
+		ob.apply(outboxEntry{Op: outboxOpAck, ID: want})
+	}
+	if item, wait := ob.next(); item != nil || wait < 59*time.Minute {
+		t.Errorf("next = %+v in %s, want nothing for an hour", item, wait)
+	}
+
+	ob.apply(outboxEntry{Op: outboxOpReplay, ID: 2})
+	if item, _ := ob.next(); item == nil || item.id != 2 {
+		t.Errorf("next after replay = %+v, want 2", item)
+	}
+}
@@ -0,0 +1,164 @@
+package binomv2postback
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit ограничение частоты запросов к одному хосту трекера.
+type RateLimit struct {
+	RequestsPerSecond float64 // средняя частота запросов
+	Burst             int     // сколько запросов можно отправить разом
+}
+
+// RateLimiterStats сколько раз и как долго запросы к хосту ждали лимита.
+type RateLimiterStats struct {
+	Requests int64
+	Waits    int64
+	Waited   time.Duration
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	stats  RateLimiterStats
+}
+
+// RateLimiter ограничивает частоту запросов отдельно для каждого хоста
+// (token bucket). Хост определяется после применения опций запроса,
+// поэтому OptWithHost и OptWithClickBaseURL попадают в свои корзины.
+type RateLimiter struct {
+	limit RateLimit
+
+	mu         sync.Mutex
+	hostLimits map[string]RateLimit
+	buckets    map[string]*tokenBucket
+}
+
+// NewRateLimiter создает RateLimiter с лимитом limit для каждого хоста.
+// Burst меньше 1 считается равным 1, нулевая частота отключает лимит.
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limit:      limit.normalize(),
+		hostLimits: make(map[string]RateLimit),
+		buckets:    make(map[string]*tokenBucket),
+	}
+}
+
+// SetHostLimit задает для хоста host лимит, отличный от общего.
+func (l *RateLimiter) SetHostLimit(host string, limit RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.hostLimits[host] = limit.normalize()
+	if b, ok := l.buckets[host]; ok {
+		b.limit = limit.normalize()
+	}
+}
+
+func (limit RateLimit) normalize() RateLimit {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+
+	return limit
+}
+
+// Wait ждет разрешения на запрос к host или отмены ctx.
+// Возвращает время ожидания. Если ожидание не укладывается в дедлайн ctx,
+// сразу возвращает context.DeadlineExceeded.
+func (l *RateLimiter) Wait(ctx context.Context, host string) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	wait := l.reserve(host)
+	if wait <= 0 {
+		return 0, nil
+	}
+	if err := sleepContext(ctx, wait); err != nil {
+		l.cancel(host)
+		return 0, err
+	}
+	l.record(host, wait)
+
+	return wait, nil
+}
+
+// reserve забирает токен из корзины host и возвращает, сколько ждать его появления.
+func (l *RateLimiter) reserve(host string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[host]
+	if !ok {
+		limit, ok := l.hostLimits[host]
+		if !ok {
+			limit = l.limit
+		}
+		b = &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		l.buckets[host] = b
+	}
+	b.stats.Requests++
+	if b.limit.RequestsPerSecond <= 0 {
+		return 0
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.RequestsPerSecond
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.limit.RequestsPerSecond * float64(time.Second))
+}
+
+// cancel возвращает токен, если запрос так и не был отправлен.
+func (l *RateLimiter) cancel(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[host]; ok {
+		b.tokens++
+		b.stats.Requests--
+	}
+}
+
+func (l *RateLimiter) record(host string, wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[host]; ok {
+		b.stats.Waits++
+		b.stats.Waited += wait
+	}
+}
+
+// Waited возвращает суммарное время ожидания запросов ко всем хостам.
+func (l *RateLimiter) Waited() time.Duration {
+	var total time.Duration
+	for _, st := range l.Stats() {
+		total += st.Waited
+	}
+
+	return total
+}
+
+// Stats возвращает статистику ожиданий по хостам.
+func (l *RateLimiter) Stats() map[string]RateLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := make(map[string]RateLimiterStats, len(l.buckets))
+	for host, b := range l.buckets {
+		stats[host] = b.stats
+	}
+
+	return stats
+}
@@ -0,0 +1,157 @@
+package binomv2postback
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	l := NewRateLimiter(RateLimit{RequestsPerSecond: 10, Burst: 3})
+	for i := 0; i < 3; i++ {
+		if wait := l.reserve("a"); wait != 0 {
+			t.Fatalf("request %d within burst waits %s", i+1, wait)
+		}
+	}
+	// четвертый запрос ждет токен: 1/10 секунды
+	if wait := l.reserve("a"); wait < 90*time.Millisecond || wait > 100*time.Millisecond {
+		t.Errorf("request after burst waits %s, want ~100ms", wait)
+	}
+	if wait := l.reserve("a"); wait < 190*time.Millisecond || wait > 200*time.Millisecond {
+		t.Errorf("second request after burst waits %s, want ~200ms", wait)
+	}
+
+	if wait := NewRateLimiter(RateLimit{RequestsPerSecond: 10}).reserve("a"); wait != 0 {
+		t.Errorf("burst 0 is not normalized to 1: first request waits %s", wait)
+	}
+	unlimited := NewRateLimiter(RateLimit{})
+	for i := 0; i < 100; i++ {
+		if wait := unlimited.reserve("a"); wait != 0 {
+			t.Fatalf("zero rate waits %s", wait)
+		}
+	}
+}
+
+func TestRateLimiterPerHost(t *testing.T) {
+	l := NewRateLimiter(RateLimit{RequestsPerSecond: 1, Burst: 1})
+	l.SetHostLimit("fast", RateLimit{RequestsPerSecond: 1000, Burst: 5})
+
+	if wait := l.reserve("a"); wait != 0 {
+		t.Fatalf("first request to a waits %s", wait)
+	}
+	if wait := l.reserve("b"); wait != 0 {
+		t.Errorf("host b shares the bucket of a: waits %s", wait)
+	}
+	if wait := l.reserve("a"); wait < 900*time.Millisecond {
+		t.Errorf("second request to a waits %s, want ~1s", wait)
+	}
+	for i := 0; i < 5; i++ {
+		if wait := l.reserve("fast"); wait != 0 {
+			t.Fatalf("request %d to fast waits %s", i+1, wait)
+		}
+	}
+
+	// новый лимит применяется и к уже созданной корзине
+	l.SetHostLimit("b", RateLimit{RequestsPerSecond: 1000, Burst: 1})
+	if wait := l.reserve("b"); wait > 10*time.Millisecond {
+		t.Errorf("host limit is not applied to the bucket: waits %s", wait)
+	}
+
+	stats := l.Stats()
+	if stats["a"].Requests != 2 || stats["b"].Requests != 2 || stats["fast"].Requests != 5 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l := NewRateLimiter(RateLimit{RequestsPerSecond: 50, Burst: 1})
+	ctx := context.Background()
+	if waited, err := l.Wait(ctx, "a"); err != nil || waited != 0 {
+		t.Fatalf("first Wait = %s, %v", waited, err)
+	}
+	start := time.Now()
+	waited, err := l.Wait(ctx, "a")
+	if err != nil || waited <= 0 || time.Since(start) < waited {
+		t.Fatalf("second Wait = %s, %v after %s", waited, err, time.Since(start))
+	}
+	if st := l.Stats()["a"]; st.Waits != 1 || st.Waited != waited || l.Waited() != waited {
+		t.Errorf("stats = %+v, Waited = %s", st, l.Waited())
+	}
+
+	var nilLimiter *RateLimiter
+	if waited, err := nilLimiter.Wait(ctx, "a"); waited != 0 || err != nil {
+		t.Errorf("nil limiter Wait = %s, %v", waited, err)
+	}
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+	l := NewRateLimiter(RateLimit{RequestsPerSecond: 1, Burst: 1})
+	l.Wait(context.Background(), "a")
+
+	// отмена во время ожидания возвращает токен
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := l.Wait(ctx, "a"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled Wait: %v", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("canceled Wait returned after %s", d)
+	}
+	// дедлайн раньше токена: ошибка без ожидания
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if _, err := l.Wait(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait past the deadline: %v", err)
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("Wait past the deadline returned after %s", d)
+	}
+
+	st := l.Stats()["a"]
+	if st.Requests != 1 || st.Waits != 0 {
+		t.Errorf("canceled waits are counted: %+v", st)
+	}
+	l.mu.Lock()
+	tokens := l.buckets["a"].tokens
+	l.mu.Unlock()
+	if tokens < -0.01 {
+		t.Errorf("canceled waits keep their tokens: %f", tokens)
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	if _, err := New(WithRateLimit(RateLimit{})); err == nil {
+		t.Error("zero rate limit accepted")
+	}
+
+	var requests atomic.Int32
+	tr := retryTransport(&requests, nil, 200)
+	limiter := NewRateLimiter(RateLimit{RequestsPerSecond: 1, Burst: 1})
+	// общий лимитер делит корзину хоста между клиентами
+	a := newDedupTestClient(t, tr, WithRateLimiter(limiter))
+	b := newDedupTestClient(t, tr, WithRateLimiter(limiter))
+	if err := a.SendEvent("c1", binom.Event(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := b.SendEvent("c1", binom.Event(1, 1), OptWithContext(ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second client is not limited: %v", err)
+	}
+	// другой хост ограничивается своей корзиной
+	if err := b.SendEvent("c1", binom.Event(1, 1), OptWithHost("other.example")); err != nil {
+		t.Errorf("other host: %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+	if stats := limiter.Stats(); stats["binom.example"].Requests != 1 || stats["other.example"].Requests != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
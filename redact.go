@@ -0,0 +1,119 @@
+package binomv2postback
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// redactedValue подставляется вместо значений секретных аргументов
+const redactedValue = "REDACTED"
+
+// DefaultSensitiveParams аргументы URL, значения которых вырезаются из логов,
+// ошибок и вывода dryRun.
+var DefaultSensitiveParams = []string{"upd_key", "api_key"}
+
+// redactURL возвращает URL с вырезанными значениями DefaultSensitiveParams.
+func redactURL(u *url.URL) string {
+	return redactURLParams(u, DefaultSensitiveParams)
+}
+
+// redactURLParams возвращает URL с вырезанными значениями аргументов params.
+// Порядок аргументов сохраняется.
+func redactURLParams(u *url.URL, params []string) string {
+	if u == nil {
+		return ""
+	}
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	cp := *u
+	cp.RawQuery = redactQuery(u.RawQuery, params)
+
+	return cp.String()
+}
+
+// redactQuery вырезает значения аргументов params из строки запроса.
+func redactQuery(rawQuery string, params []string) string {
+	parts := strings.Split(rawQuery, "&")
+	for i, part := range parts {
+		name, _, _ := strings.Cut(part, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		for _, param := range params {
+			if name == param {
+				parts[i] = param + "=" + redactedValue
+				break
+			}
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// redactString вырезает секреты из произвольной строки, содержащей URL.
+func redactString(s string, params []string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.RawQuery == "" {
+		return s
+	}
+
+	return redactURLParams(u, params)
+}
+
+// redactError убирает секреты из URL в ошибке http.Client,
+// которая содержит полный адрес запроса.
+func redactError(err error, params []string) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		uerr.URL = redactString(uerr.URL, params)
+	}
+
+	return err
+}
+
+// redactText вырезает значения аргументов params из произвольного текста,
+// например тела ответа трекера, в котором может повторяться адрес запроса.
+// Значение заканчивается на &, пробельном символе, кавычке или угловой скобке.
+func redactText(s string, params []string) string {
+	for _, param := range params {
+		var b strings.Builder
+		rest := s
+		for {
+			i := strings.Index(rest, param+"=")
+			if i < 0 {
+				break
+			}
+			i += len(param) + 1
+			b.WriteString(rest[:i])
+			b.WriteString(redactedValue)
+			rest = rest[i:]
+			end := strings.IndexAny(rest, "&\"'<> \t\r\n")
+			if end < 0 {
+				end = len(rest)
+			}
+			rest = rest[end:]
+		}
+		if b.Len() > 0 {
+			b.WriteString(rest)
+			s = b.String()
+		}
+	}
+
+	return s
+}
+
+// maxLoggedBodySize сколько байт тела ответа попадает в лог
+const maxLoggedBodySize = 512
+
+// logBody возвращает начало тела ответа для лога без значений секретных аргументов.
+func logBody(body []byte, params []string) string {
+	s := string(body)
+	if len(body) > maxLoggedBodySize {
+		s = fmt.Sprintf("%s... (%d bytes)", body[:maxLoggedBodySize], len(body))
+	}
+
+	return redactText(s, params)
+}
@@ -0,0 +1,103 @@
+package binomv2postback
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+// testLogger запоминает записи лога с уровнем
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) add(level, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, level+" "+msg)
+}
+
+func (l *testLogger) Info(args ...interface{})  { l.add("INFO", fmt.Sprint(args...)) }
+func (l *testLogger) Error(args ...interface{}) { l.add("ERROR", fmt.Sprint(args...)) }
+func (l *testLogger) Debug(args ...interface{}) { l.add("DEBUG", fmt.Sprint(args...)) }
+
+func (l *testLogger) Infof(template string, args ...interface{}) {
+	l.add("INFO", fmt.Sprintf(template, args...))
+}
+
+func (l *testLogger) Errorf(template string, args ...interface{}) {
+	l.add("ERROR", fmt.Sprintf(template, args...))
+}
+
+func (l *testLogger) Debugf(template string, args ...interface{}) {
+	l.add("DEBUG", fmt.Sprintf(template, args...))
+}
+
+// find возвращает записи, содержащие s
+func (l *testLogger) find(s string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var out []string
+	for _, line := range l.lines {
+		if strings.Contains(line, s) {
+			out = append(out, line)
+		}
+	}
+
+	return out
+}
+
+func TestRedactText(t *testing.T) {
+	params := []string{"upd_key", "api_key"}
+	tests := []struct{ in, want string }{
+		{"ok", "ok"},
+		{"url /click.php?upd_key=secret&cnv_id=1", "url /click.php?upd_key=REDACTED&cnv_id=1"},
+		{`{"url": "?api_key=k1", "x": "upd_key=k2 done"}`, `{"url": "?api_key=REDACTED", "x": "upd_key=REDACTED done"}`},
+		{"upd_key=a upd_key=b", "upd_key=REDACTED upd_key=REDACTED"},
+		{"<a href=?upd_key=s>", "<a href=?upd_key=REDACTED>"},
+		{"upd_key=", "upd_key=REDACTED"},
+	}
+	for _, tt := range tests {
+		if got := redactText(tt.in, params); got != tt.want {
+			t.Errorf("redactText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestResponseBodyLog(t *testing.T) {
+	body := "error for ?upd_key=secret " + strings.Repeat("x", 2*maxLoggedBodySize)
+	log := &testLogger{}
+	cli, err := New(
+		WithClickBaseURL("https://binom.example/click.php"),
+		WithRetryPolicy(RetryPolicy{}),
+		WithLogger(log),
+		WithTransport(TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+			return &TransportResponse{StatusCode: http.StatusOK, Body: []byte(body)}, nil
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.SendEvents("c1", mustEvents(t, binom.Event(1, 1)))
+
+	lines := log.find("Response: 200")
+	if len(lines) != 1 {
+		t.Fatalf("response log = %q", log.lines)
+	}
+	line := lines[0]
+	if !strings.HasPrefix(line, "DEBUG ") {
+		t.Errorf("response body logged at %s", line[:strings.IndexByte(line, ' ')])
+	}
+	if strings.Contains(line, "secret") {
+		t.Errorf("secret in the response log: %s", line)
+	}
+	if len(line) > maxLoggedBodySize+200 || !strings.Contains(line, fmt.Sprintf("(%d bytes)", len(body))) {
+		t.Errorf("response body is not truncated: %d bytes logged", len(line))
+	}
+}
@@ -5,12 +5,17 @@ import "strings"
 // RequestBuilder allows you to construct Request interface
 type RequestBuilder interface {
 	Request(clickID string) Request
+	Build(clickID string) (Request, error)
 	WithPayout(payout float64) RequestBuilder
+	WithPayoutMoney(payout Money) RequestBuilder
 	WithEvents(events Events) RequestBuilder
 	WithStatus(cnvStatus string, cnvStatus2 ...string) RequestBuilder
 	WithPostbackMode(mode string) RequestBuilder
 	DropStatus(keepPrimary bool) RequestBuilder
 	DropConversion() RequestBuilder
+	WithCurrency(currency Currency) RequestBuilder
+	WithStatusModel(model *StatusModel, lastStatus string) RequestBuilder
+	Err() error
 	ClickID() string
 	Mode() string
 }
@@ -32,6 +37,10 @@ func NewRequestBuilderWithClickID(clickID string) RequestBuilder {
 type requestBuilder struct {
 	req  *request
 	mode string
+
+	statusModel *StatusModel
+	lastStatus  string
+	err         error // first error of With* methods, see Err
 }
 
 // Return request clickID
@@ -44,7 +53,9 @@ func (r *requestBuilder) Mode() string {
 	return r.mode
 }
 
-// Request method create a copy of builder and apply clickID to it
+// Request method create a copy of builder and apply clickID to it.
+// Request does not check the builder, use Build to get the errors of Err
+// for the given clickID.
 func (r *requestBuilder) Request(clickID string) Request {
 	req := *r.req
 	req.clickID = clickID
@@ -52,15 +63,42 @@ func (r *requestBuilder) Request(clickID string) Request {
 	return &req
 }
 
+// Build works like Request but returns the error of Err instead of an invalid
+// Request. The status model error names clickID.
+func (r *requestBuilder) Build(clickID string) (Request, error) {
+	if err := r.validate(clickID); err != nil {
+		return nil, err
+	}
+
+	return r.Request(clickID), nil
+}
+
 // WithEvents add click events to builded Request
 func (r *requestBuilder) WithEvents(events Events) RequestBuilder {
 	r.req.events = events
 	return r
 }
 
-// WithPayout add conversion payout to builded Request
+// WithPayout add conversion payout to builded Request.
+// The payout is kept as its shortest decimal form, see MoneyFromFloat.
+// NaN and infinite payouts are reported by Err.
 func (r *requestBuilder) WithPayout(payout float64) RequestBuilder {
-	r.req.payout = &payout
+	m, err := MoneyFromFloat(payout, "")
+	if err != nil {
+		if r.err == nil {
+			r.err = err
+		}
+		return r
+	}
+	r.req.setPayout(m)
+
+	return r
+}
+
+// WithPayoutMoney add conversion payout to builded Request.
+// A payout with currency also sets the conversion currency.
+func (r *requestBuilder) WithPayoutMoney(payout Money) RequestBuilder {
+	r.req.setPayout(payout)
 	return r
 }
 
@@ -88,10 +126,15 @@ func (r *requestBuilder) DisablePostback() RequestBuilder {
 	return r
 }
 
-// WithCurrency setup conversion currency
-func (r *requestBuilder) WithCurrency(currency string) RequestBuilder {
-	// TODO: validate currency
-	r.req.currency = &currency
+// WithCurrency setup conversion currency.
+// Codes that are not ISO 4217 are reported by Err and Build,
+// and the client refuses to send them.
+func (r *requestBuilder) WithCurrency(currency Currency) RequestBuilder {
+	if parsed, err := ParseCurrency(string(currency)); err == nil {
+		currency = parsed
+	}
+	code := string(currency)
+	r.req.currency = &code
 
 	return r
 }
@@ -103,6 +146,39 @@ func (r *requestBuilder) WithToOffer(toOffer uint64) RequestBuilder {
 	return r
 }
 
+// WithStatusModel makes Err and Build check the conversion status against model.
+// lastStatus is the last known status of the click, empty if unknown.
+func (r *requestBuilder) WithStatusModel(model *StatusModel, lastStatus string) RequestBuilder {
+	r.statusModel = model
+	r.lastStatus = lastStatus
+
+	return r
+}
+
+// Err returns ErrInvalidMoney for a payout that can not be sent,
+// ErrUnknownCurrency for a currency that is not ISO 4217, or
+// StatusTransitionError if the conversion status is unknown
+// to the status model or can not follow the last known status.
+func (r *requestBuilder) Err() error {
+	return r.validate(r.req.clickID)
+}
+
+func (r *requestBuilder) validate(clickID string) error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.req.currency != nil {
+		if _, err := ParseCurrency(*r.req.currency); err != nil {
+			return err
+		}
+	}
+	if r.statusModel == nil || r.req.cnvStatus == nil {
+		return nil
+	}
+
+	return r.statusModel.Validate(clickID, r.lastStatus, *r.req.cnvStatus)
+}
+
 // DropStatus clear request data about conversion status.
 // if keepPrimary is true it clear only secondary conversion status
 func (r *requestBuilder) DropStatus(keepPrimary bool) RequestBuilder {
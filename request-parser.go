@@ -0,0 +1,213 @@
+package binomv2postback
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+// ParseQuery разбирает аргументы postback URL в формате Binom в Request.
+// ID клика берется из cnv_id (конверсия), либо из clickid/upd_clickid (обновление событий).
+// Неизвестные аргументы игнорируются.
+func ParseQuery(q url.Values) (Request, error) {
+	req := &request{}
+	switch {
+	case q.Get("cnv_id") != "":
+		req.clickID = q.Get("cnv_id")
+		req.isCnv = true
+	case q.Get("clickid") != "":
+		req.clickID = q.Get("clickid")
+	case q.Get("upd_clickid") != "":
+		req.clickID = q.Get("upd_clickid")
+	default:
+		return nil, ErrMissingClickID
+	}
+
+	for name, values := range q {
+		if len(values) == 0 {
+			continue
+		}
+		if err := req.setParam(name, values[len(values)-1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
+// setParam устанавливает аргумент name в формате Binom (payout, cnv_status, eventN...).
+// Аргументы конверсии (payout, cnv_status, cnv_status2, cnv_currency) делают запрос конверсией.
+// Неизвестные аргументы игнорируются.
+func (p *request) setParam(name, value string) error {
+	paramErr := func(err error) error {
+		return &ParamError{Param: name, Value: value, Err: err}
+	}
+
+	switch name {
+	case "payout", "cnv_status", "cnv_status2", "cnv_currency":
+		p.isCnv = true
+	}
+	switch name {
+	case "payout":
+		payout, err := ParseMoney(value, "")
+		if err != nil {
+			return paramErr(err)
+		}
+		p.payout = &payout
+	case "cnv_status":
+		p.cnvStatus = &value
+	case "cnv_status2":
+		p.cnvStatus2 = &value
+	case "cnv_currency":
+		currency, err := ParseCurrency(value)
+		if err != nil {
+			return paramErr(err)
+		}
+		code := string(currency)
+		p.currency = &code
+	case "to_offer":
+		toOffer, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return paramErr(err)
+		}
+		p.toOffer = &toOffer
+	case "disable_postback":
+		disable, err := strconv.ParseBool(value)
+		if err != nil {
+			return paramErr(err)
+		}
+		p.disablePostback = disable
+	default:
+		ev, ok, err := parseEventParam(name, value)
+		if err != nil {
+			return paramErr(err)
+		}
+		if ok {
+			if err := p.events.Set(ev, true); err != nil {
+				return paramErr(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseEventParam разбирает аргумент eventN=INT или add_eventN=INT.
+// Если name не является событием, возвращает ok=false.
+func parseEventParam(name, value string) (ev Event, ok bool, err error) {
+	var add bool
+	switch {
+	case strings.HasPrefix(name, "add_event"):
+		add = true
+		name = strings.TrimPrefix(name, "add_event")
+	case strings.HasPrefix(name, "event"):
+		name = strings.TrimPrefix(name, "event")
+	default:
+		return nil, false, nil
+	}
+
+	index, err := strconv.ParseInt(name, 10, 8)
+	if err != nil {
+		return nil, false, nil
+	}
+	if index < 1 || index > MaxEventIndex {
+		return nil, true, ErrEventIndexOutOfRange
+	}
+	val, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, true, errors.New("event value must be an integer")
+	}
+	if add {
+		return binom.AddEvent(int8(index), val), true, nil
+	}
+
+	return binom.Event(int8(index), val), true, nil
+}
+
+// ParseRequest разбирает строку в формате обновления конверсий Binom,
+// который возвращает Request.String(): clickid:payout=1.5:cnv_status=approved:event1=2
+func ParseRequest(s string) (Request, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if parts[0] == "" {
+		return nil, ErrMissingClickID
+	}
+
+	req := &request{clickID: parts[0]}
+	for _, part := range parts[1:] {
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, &ParamError{Param: name, Err: errors.New("expected name=value")}
+		}
+		if err := req.setParam(name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
+// RequestScanner построчно читает файл запросов в формате Request.String().
+// Пустые строки и строки, начинающиеся с #, пропускаются.
+//
+//	scanner := NewRequestScanner(f)
+//	for scanner.Scan() {
+//		req, err := scanner.Request()
+//		...
+//	}
+//	if err := scanner.Err(); err != nil {
+//		...
+//	}
+type RequestScanner struct {
+	scanner *bufio.Scanner
+	line    int
+	req     Request
+	err     error
+}
+
+// NewRequestScanner создает RequestScanner, читающий из r.
+func NewRequestScanner(r io.Reader) *RequestScanner {
+	return &RequestScanner{scanner: bufio.NewScanner(r)}
+}
+
+// Scan переходит к следующему запросу. Возвращает false в конце файла или при ошибке чтения.
+func (s *RequestScanner) Scan() bool {
+	for s.scanner.Scan() {
+		s.line++
+		text := strings.TrimSpace(s.scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		s.req, s.err = ParseRequest(text)
+		if s.err != nil {
+			s.err = fmt.Errorf("line %d: %w", s.line, s.err)
+		}
+		return true
+	}
+
+	return false
+}
+
+// Request возвращает текущий запрос или ошибку его разбора.
+// Ошибка разбора одной строки не останавливает чтение файла.
+func (s *RequestScanner) Request() (Request, error) {
+	return s.req, s.err
+}
+
+// Line возвращает номер текущей строки файла.
+func (s *RequestScanner) Line() int {
+	return s.line
+}
+
+// Err возвращает ошибку чтения файла.
+func (s *RequestScanner) Err() error {
+	return s.scanner.Err()
+}
@@ -0,0 +1,153 @@
+package binomv2postback
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+func TestParseRequestRoundTrip(t *testing.T) {
+	events, err := NewEvents(binom.Event(1, 2), binom.AddEvent(5, 3), binom.Event(10, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payout, err := ParseMoney("10.50", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := NewRequestBuilder().
+		WithPayoutMoney(payout).
+		WithCurrency("EUR").
+		WithStatus("approved", "paid").
+		WithEvents(events)
+	if err := builder.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	toOffer := uint64(2)
+	eur := "EUR"
+	tests := []Request{
+		builder.Request("abc123"),
+		NewRequestBuilder().WithStatus("rejected").Request("c1"),
+		NewRequestBuilder().WithEvents(events).Request("c2"),
+		&request{clickID: "c3", toOffer: &toOffer, disablePostback: true},
+		NewRequestBuilder().WithCurrency("EUR").WithEvents(events).Request("c4"),
+		&request{clickID: "c5", currency: &eur, isCnv: true},
+		NewRequestBuilder().WithStatus("", "paid").Request("c6"),
+		NewRequestBuilder().WithPayout(0).Request("c7"),
+	}
+	for _, req := range tests {
+		s := req.String()
+		parsed, err := ParseRequest(s)
+		if err != nil {
+			t.Errorf("ParseRequest(%q): %v", s, err)
+			continue
+		}
+		if got := parsed.String(); got != s {
+			t.Errorf("ParseRequest(%q).String() = %q", s, got)
+		}
+		if parsed.IsConversion() != req.IsConversion() {
+			t.Errorf("ParseRequest(%q).IsConversion() = %v", s, parsed.IsConversion())
+		}
+		if got, want := parsed.URLParam(), req.URLParam(); got != want {
+			t.Errorf("ParseRequest(%q).URLParam() = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestParseRequestFields(t *testing.T) {
+	req, err := ParseRequest(" abc:payout=1.50:cnv_currency=usd:cnv_status=approved::event3=7:add_event4=1 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.ClickID() != "abc" || req.Payout() != "1.5" || req.Currency() != "USD" || req.ConversionStatus() != "approved" {
+		t.Errorf("request = %s", req)
+	}
+	events := req.Events()
+	if ev, ok := events.Get(3); !ok || ev.Value() != 7 {
+		t.Errorf("event3 = %v, %v", ev, ok)
+	}
+	if ev, ok := events.Get(4); !ok || ev.Value() != 1 {
+		t.Errorf("event4 = %v, %v", ev, ok)
+	}
+}
+
+func TestParseRequestConversion(t *testing.T) {
+	for s, want := range map[string]bool{
+		"abc:payout=1":             true,
+		"abc:cnv_status=approved":  true,
+		"abc:cnv_status2=paid":     true,
+		"abc:cnv_currency=usd":     true,
+		"abc:event1=2":             false,
+		"abc:to_offer=1":           false,
+		"abc:disable_postback=1":   false,
+		"abc":                      false,
+		"abc:event1=2:payout=0.00": true,
+	} {
+		req, err := ParseRequest(s)
+		if err != nil {
+			t.Errorf("ParseRequest(%q): %v", s, err)
+			continue
+		}
+		if got := req.(*request).isCnv; got != want {
+			t.Errorf("ParseRequest(%q) isCnv = %v, want %v", s, got, want)
+		}
+		if got := req.IsConversion(); got != want {
+			t.Errorf("ParseRequest(%q).IsConversion() = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestParseRequestErrors(t *testing.T) {
+	if _, err := ParseRequest(":payout=1"); !errors.Is(err, ErrMissingClickID) {
+		t.Errorf("missing click id: %v", err)
+	}
+
+	var paramErr *ParamError
+	for _, s := range []string{"abc:payout", "abc:payout=x", "abc:cnv_currency=XYZ", "abc:event1=a", "abc:to_offer=-1"} {
+		if _, err := ParseRequest(s); !errors.As(err, &paramErr) {
+			t.Errorf("ParseRequest(%q) = %v, want ParamError", s, err)
+		}
+	}
+	if _, err := ParseRequest("abc:event99=1"); !errors.Is(err, ErrEventIndexOutOfRange) {
+		t.Errorf("event index out of range: %v", err)
+	}
+}
+
+func TestRequestScanner(t *testing.T) {
+	input := strings.Join([]string{
+		"# comment",
+		"abc:payout=1",
+		"",
+		"bad:payout=x",
+		"def:event1=2",
+	}, "\n")
+
+	scanner := NewRequestScanner(strings.NewReader(input))
+	var lines []int
+	var clickIDs []string
+	var errs int
+	for scanner.Scan() {
+		lines = append(lines, scanner.Line())
+		req, err := scanner.Request()
+		if err != nil {
+			if !strings.HasPrefix(err.Error(), "line 4: ") {
+				t.Errorf("error = %v", err)
+			}
+			errs++
+			continue
+		}
+		clickIDs = append(clickIDs, req.ClickID())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(clickIDs, ",") != "abc,def" || errs != 1 {
+		t.Errorf("click ids %q, %d errors", clickIDs, errs)
+	}
+	if len(lines) != 3 || lines[0] != 2 || lines[1] != 4 || lines[2] != 5 {
+		t.Errorf("lines = %v", lines)
+	}
+}
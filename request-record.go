@@ -0,0 +1,143 @@
+package binomv2postback
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+// requestRecord сериализуемое представление Request,
+// используется там, где запрос нужно сохранить и восстановить без потерь.
+type requestRecord struct {
+	ClickID         string        `json:"click_id"`
+	Payout          *Money        `json:"payout,omitempty"`
+	CnvStatus       *string       `json:"cnv_status,omitempty"`
+	CnvStatus2      *string       `json:"cnv_status2,omitempty"`
+	Currency        *string       `json:"currency,omitempty"`
+	IsCnv           bool          `json:"is_cnv,omitempty"`
+	Events          []eventRecord `json:"events,omitempty"`
+	DisablePostback bool          `json:"disable_postback,omitempty"`
+	ToOffer         *uint64       `json:"to_offer,omitempty"`
+	// выплата до перевода в базовую валюту
+	OriginalPayout   *Money  `json:"original_payout,omitempty"`
+	OriginalCurrency *string `json:"original_currency,omitempty"`
+}
+
+type eventRecord struct {
+	Type  string `json:"type"`
+	Index int8   `json:"index"`
+	Value int64  `json:"value"`
+}
+
+func newEventRecords(events Events) []eventRecord {
+	var out []eventRecord
+	for _, ev := range events.List() {
+		out = append(out, eventRecord{Type: ev.Type(), Index: ev.Index(), Value: ev.Value()})
+	}
+
+	return out
+}
+
+func (r eventRecord) event() (Event, error) {
+	switch r.Type {
+	case "event":
+		return binom.Event(r.Index, r.Value), nil
+	case "add_event":
+		return binom.AddEvent(r.Index, r.Value), nil
+	}
+
+	return nil, fmt.Errorf("unknown event type %q", r.Type)
+}
+
+func eventsFromRecords(records []eventRecord) (Events, error) {
+	events := Events{}
+	for _, r := range records {
+		ev, err := r.event()
+		if err != nil {
+			return events, err
+		}
+		if err := events.Set(ev, true); err != nil {
+			return events, err
+		}
+	}
+
+	return events, nil
+}
+
+// newRequestRecord копирует данные Request. Для собственной реализации
+// копируются поля как есть, для чужих реализаций данные берутся из методов.
+func newRequestRecord(req Request) requestRecord {
+	if p, ok := req.(*request); ok {
+		return requestRecord{
+			ClickID:         p.clickID,
+			Payout:          p.payout,
+			CnvStatus:       p.cnvStatus,
+			CnvStatus2:      p.cnvStatus2,
+			Currency:        p.currency,
+			IsCnv:           p.isCnv,
+			Events:          newEventRecords(p.events),
+			DisablePostback: p.disablePostback,
+			ToOffer:         p.toOffer,
+
+			OriginalPayout:   p.originalPayout,
+			OriginalCurrency: p.originalCurrency,
+		}
+	}
+
+	rec := requestRecord{
+		ClickID:         req.ClickID(),
+		IsCnv:           req.IsConversion(),
+		Events:          newEventRecords(req.Events()),
+		DisablePostback: req.IsDisabledPostback(),
+	}
+	if v := req.ConversionStatus(); v != "" {
+		rec.CnvStatus = &v
+	}
+	if v := req.ConversionStatus2(); v != "" {
+		rec.CnvStatus2 = &v
+	}
+	if v := req.Currency(); v != "" {
+		rec.Currency = &v
+	}
+	if mr, ok := req.(MoneyRequest); ok {
+		if v := mr.OriginalCurrency(); v != "" {
+			rec.OriginalCurrency = &v
+		}
+		if payout, err := ParseMoney(mr.OriginalPayout(), ""); err == nil {
+			rec.OriginalPayout = &payout
+		}
+	}
+	if payout, ok := payoutMoney(req); ok {
+		payout = payout.WithCurrency("")
+		rec.Payout = &payout
+	}
+	if toOffer, err := strconv.ParseUint(req.ToOffer(), 10, 64); err == nil {
+		rec.ToOffer = &toOffer
+	}
+
+	return rec
+}
+
+// request восстанавливает Request из записи.
+func (r requestRecord) request() (*request, error) {
+	events, err := eventsFromRecords(r.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	return &request{
+		clickID:         r.ClickID,
+		payout:          r.Payout,
+		cnvStatus:       r.CnvStatus,
+		cnvStatus2:      r.CnvStatus2,
+		currency:        r.Currency,
+		isCnv:           r.IsCnv,
+		events:          events,
+		disablePostback: r.DisablePostback,
+		toOffer:         r.ToOffer,
+
+		originalPayout:   r.OriginalPayout,
+		originalCurrency: r.OriginalCurrency,
+	}, nil
+}
@@ -20,9 +20,33 @@ type Request interface {
 	ToOffer() string
 }
 
+// MoneyRequest необязательное расширение Request: выплата в виде Money и выплата
+// до перевода в базовую валюту (см. PayoutNormalizer). Request библиотеки его
+// реализуют, у прочих реализаций выплата разбирается из Payout и Currency.
+type MoneyRequest interface {
+	Request
+	PayoutMoney() (Money, bool)
+	OriginalPayout() string
+	OriginalCurrency() string
+}
+
+// payoutMoney возвращает выплату req в валюте Currency,
+// ok=false если выплаты нет или ее нельзя разобрать.
+func payoutMoney(req Request) (Money, bool) {
+	if mr, ok := req.(MoneyRequest); ok {
+		return mr.PayoutMoney()
+	}
+	payout, err := ParseMoney(req.Payout(), "")
+	if err != nil {
+		return Money{}, false
+	}
+
+	return payout.WithCurrency(Currency(req.Currency())), true
+}
+
 type request struct {
 	clickID         string
-	payout          *float64
+	payout          *Money
 	cnvStatus       *string
 	cnvStatus2      *string
 	currency        *string
@@ -30,6 +54,10 @@ type request struct {
 	events          Events
 	disablePostback bool
 	toOffer         *uint64
+
+	// выплата и валюта до перевода в базовую валюту, см. PayoutNormalizer
+	originalPayout   *Money
+	originalCurrency *string
 }
 
 func (p *request) ClickID() string {
@@ -41,7 +69,16 @@ func (p *request) Payout() string {
 		return ""
 	}
 
-	return strconv.FormatFloat(*p.payout, 'g', -1, 64)
+	return p.payout.String()
+}
+
+// PayoutMoney возвращает выплату в валюте Currency, ok=false если выплаты нет
+func (p *request) PayoutMoney() (Money, bool) {
+	if p.payout == nil {
+		return Money{}, false
+	}
+
+	return p.payout.WithCurrency(Currency(p.Currency())), true
 }
 
 func (p *request) ConversionStatus() string {
@@ -68,13 +105,41 @@ func (p *request) Currency() string {
 	return *p.currency
 }
 
+// setPayout задает выплату, валюта суммы (если есть) становится cnv_currency
+func (p *request) setPayout(payout Money) {
+	if currency := payout.Currency(); currency != "" {
+		code := string(currency)
+		p.currency = &code
+	}
+	payout = payout.WithCurrency("")
+	p.payout = &payout
+}
+
+// OriginalPayout выплата до перевода в базовую валюту, пусто если перевода не было
+func (p *request) OriginalPayout() string {
+	if p.originalPayout == nil {
+		return ""
+	}
+
+	return p.originalPayout.String()
+}
+
+// OriginalCurrency валюта выплаты до перевода в базовую валюту, пусто если перевода не было
+func (p *request) OriginalCurrency() string {
+	if p.originalCurrency == nil {
+		return ""
+	}
+
+	return *p.originalCurrency
+}
+
 func (p *request) Events() Events {
 	return p.events
 }
 
 func (p *request) IsConversion() bool {
-	// Это конверсия - если это прописано явно в запросе, есть какой-то статус или payout.
-	if p.isCnv || p.cnvStatus != nil || p.cnvStatus2 != nil || p.payout != nil {
+	// Это конверсия - если это прописано явно в запросе, есть какой-то статус, payout или валюта.
+	if p.isCnv || p.cnvStatus != nil || p.cnvStatus2 != nil || p.payout != nil || p.currency != nil {
 		return true
 	}
 
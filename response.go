@@ -0,0 +1,201 @@
+package binomv2postback
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MaxResponseBodySize сколько байт тела ответа трекера читается, остальное отбрасывается
+const MaxResponseBodySize = 64 << 10
+
+// ResponseResult что трекер сделал с запросом
+type ResponseResult string
+
+const (
+	ResultAccepted          ResponseResult = "accepted"           // запрос принят, ответ не распознан
+	ResultConversionCreated ResponseResult = "conversion_created" // создана конверсия
+	ResultConversionUpdated ResponseResult = "conversion_updated" // обновлена существующая конверсия
+	ResultClickUpdated      ResponseResult = "click_updated"      // обновлены события клика
+	ResultRejected          ResponseResult = "rejected"           // запрос не принят, см. ошибку отправки
+	ResultDryRun            ResponseResult = "dry_run"            // запрос не отправлялся
+	ResultSkipped           ResponseResult = "skipped"            // пустое обновление не отправлялось, см. WithEmptyUpdates
+)
+
+var (
+	// ErrClickNotFound трекер не нашел клик из запроса
+	ErrClickNotFound = errors.New("click not found")
+	// ErrInvalidUPDKey трекер отклонил upd_key
+	ErrInvalidUPDKey = errors.New("invalid upd_key")
+	// ErrRequestRejected трекер ответил ошибкой, которую не удалось распознать
+	ErrRequestRejected = errors.New("request rejected by tracker")
+)
+
+// Response ответ трекера на postback или обновление клика.
+type Response struct {
+	StatusCode int
+	Result     ResponseResult
+	Message    string // текст ответа или сообщение из JSON-ответа
+	Body       []byte
+	Truncated  bool // тело длиннее MaxResponseBodySize и обрезано
+}
+
+// TrackerError трекер ответил 200, но не выполнил запрос.
+// Причина доступна через errors.Is: ErrClickNotFound, ErrInvalidUPDKey или ErrRequestRejected.
+type TrackerError struct {
+	URL     string
+	Message string
+	Err     error
+}
+
+func (e *TrackerError) Error() string {
+	return fmt.Sprintf("binom rejected request %s: %s", e.URL, e.Message)
+}
+
+func (e *TrackerError) Unwrap() error {
+	return e.Err
+}
+
+// OptWithResponse сохраняет в resp ответ трекера на последнюю попытку запроса,
+// чтобы узнать, создал трекер конверсию, обновил ее или только события клика.
+func OptWithResponse(resp *Response) sendClickOpt {
+	return func(cli *client, clkReq *clickReq) error {
+		clkReq.response = resp
+		return nil
+	}
+}
+
+// response разбирает ответ трекера и возвращает ошибку, если трекер не выполнил запрос.
+func (r *clickResp) response() (*Response, error) {
+	if r.DryRun {
+		return &Response{Result: ResultDryRun}, nil
+	}
+
+	message := responseMessage(r.Body)
+	result, err := classifyResponse(r.Body)
+	resp := &Response{
+		StatusCode: r.StatusCode,
+		Result:     result,
+		Message:    message,
+		Body:       r.Body,
+		Truncated:  r.Truncated,
+	}
+	if r.StatusCode != http.StatusOK {
+		resp.Result = ResultRejected
+		statusErr := r.statusError()
+		statusErr.Err = err
+		return resp, statusErr
+	}
+	if err != nil {
+		return resp, &TrackerError{URL: r.RedactedURL, Message: message, Err: err}
+	}
+
+	return resp, nil
+}
+
+// responseFields строковые поля JSON-ответа трекера с текстом ответа
+var responseFields = []string{"status", "result", "message", "error", "msg"}
+
+// responseMessage возвращает текст ответа. Из JSON-ответа берутся
+// строковые поля status, result, message, error и msg.
+func responseMessage(body []byte) string {
+	if fields, ok := responseJSON(body); ok {
+		if parts := responseStrings(fields); len(parts) > 0 {
+			return strings.Join(parts, ": ")
+		}
+	}
+
+	return string(bytes.TrimSpace(body))
+}
+
+// responseJSON разбирает JSON-объект ответа.
+func responseJSON(body []byte) (map[string]interface{}, bool) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '{' {
+		return nil, false
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(body, &fields) != nil {
+		return nil, false
+	}
+
+	return fields, true
+}
+
+// responseStrings возвращает непустые строковые поля responseFields.
+func responseStrings(fields map[string]interface{}) []string {
+	var out []string
+	for _, key := range responseFields {
+		if s, ok := fields[key].(string); ok && s != "" {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+type knownResponse struct {
+	result ResponseResult
+	err    error
+}
+
+// binomResponses известные ответы обработчика клика Binom,
+// сравниваются без учета регистра и точки в конце.
+var binomResponses = map[string]knownResponse{
+	"click not found":      {ResultRejected, ErrClickNotFound},
+	"clickid not found":    {ResultRejected, ErrClickNotFound},
+	"wrong upd_key":        {ResultRejected, ErrInvalidUPDKey},
+	"invalid upd_key":      {ResultRejected, ErrInvalidUPDKey},
+	"conversion created":   {ResultConversionCreated, nil},
+	"conversion added":     {ResultConversionCreated, nil},
+	"conversion updated":   {ResultConversionUpdated, nil},
+	"click updated":        {ResultClickUpdated, nil},
+	"events updated":       {ResultClickUpdated, nil},
+	"click events updated": {ResultClickUpdated, nil},
+}
+
+// classifyResponse определяет по ответу, что сделал трекер. Распознаются только
+// известные ответы Binom и JSON-ответ с ошибкой ({"status": "error"},
+// {"success": false} или непустой "error"), любой другой ответ считается принятым.
+func classifyResponse(body []byte) (ResponseResult, error) {
+	fields, isJSON := responseJSON(body)
+	texts := []string{string(body)}
+	if isJSON {
+		texts = responseStrings(fields)
+	}
+	for _, text := range texts {
+		key := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(text)), ".")
+		if known, ok := binomResponses[key]; ok {
+			return known.result, known.err
+		}
+	}
+	if isJSON && jsonRejected(fields) {
+		return ResultRejected, ErrRequestRejected
+	}
+
+	return ResultAccepted, nil
+}
+
+// jsonRejected сообщает, что JSON-ответ трекера явно сообщает об ошибке.
+func jsonRejected(fields map[string]interface{}) bool {
+	if status, ok := fields["status"].(string); ok {
+		switch strings.ToLower(status) {
+		case "error", "fail", "failed":
+			return true
+		}
+	}
+	if success, ok := fields["success"].(bool); ok && !success {
+		return true
+	}
+	switch v := fields["error"].(type) {
+	case string:
+		return v != ""
+	case bool:
+		return v
+	}
+
+	return false
+}
@@ -0,0 +1,169 @@
+package binomv2postback
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy описывает повторы неудачных запросов к трекеру.
+// Задержка между попытками растет экспоненциально от BaseDelay до MaxDelay,
+// Jitter (0..1) задает долю случайного разброса задержки.
+// Нулевое значение политики означает одну попытку без повторов.
+type RetryPolicy struct {
+	MaxAttempts          int           // всего попыток, включая первую
+	BaseDelay            time.Duration // задержка перед второй попыткой
+	MaxDelay             time.Duration // верхняя граница задержки
+	Jitter               float64       // доля случайного разброса задержки
+	RetryableStatusCodes []int         // коды ответа, после которых запрос повторяется
+	// MaxRetryAfter верхняя граница ожидания по Retry-After ответа трекера.
+	// 0 - ограничение MaxDelay, а без него DefaultMaxRetryAfter.
+	MaxRetryAfter time.Duration
+}
+
+// DefaultMaxRetryAfter граница Retry-After для политики без MaxRetryAfter и MaxDelay
+const DefaultMaxRetryAfter = 30 * time.Second
+
+// DefaultRetryPolicy возвращает политику с 4 попытками и повтором на 429 и 5xx ответах.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		Jitter:      0.2,
+		RetryableStatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// OptWithRetryPolicy задает политику повторов для конкретного запроса.
+func OptWithRetryPolicy(policy RetryPolicy) sendClickOpt {
+	return func(cli *client, clkReq *clickReq) error {
+		if clkReq != nil && clkReq.log != nil {
+			clkReq.log.Debugf("setup click request with retry policy option: %+v", policy)
+		}
+		clkReq.retry = policy
+
+		return nil
+	}
+}
+
+// OptNoRetry отключает повторы для конкретного запроса.
+func OptNoRetry() sendClickOpt {
+	return OptWithRetryPolicy(RetryPolicy{})
+}
+
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+
+	return p.MaxAttempts
+}
+
+// retryable решает, стоит ли повторять запрос после ответа resp или ошибки err.
+func (p RetryPolicy) retryable(ctx context.Context, resp *clickResp, err error) bool {
+	if ctx != nil && ctx.Err() != nil {
+		return false
+	}
+	if resp == nil {
+		// ошибка транспорта, отмену контекста не повторяем
+		var terr *TransportError
+		return errors.As(err, &terr) && terr.Retryable()
+	}
+	for _, code := range p.RetryableStatusCodes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// delay возвращает задержку перед попыткой attempt+1.
+// Retry-After из ответа трекера имеет приоритет над экспоненциальной задержкой,
+// но не больше maxRetryAfter.
+func (p RetryPolicy) delay(attempt int, resp *clickResp) time.Duration {
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header); ok {
+			return min(d, p.maxRetryAfter())
+		}
+	}
+
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 && d > 0 {
+		spread := float64(d) * p.Jitter
+		d += time.Duration(spread * (2*rand.Float64() - 1))
+	}
+	if d < 0 {
+		return 0
+	}
+
+	return d
+}
+
+func (p RetryPolicy) maxRetryAfter() time.Duration {
+	switch {
+	case p.MaxRetryAfter > 0:
+		return p.MaxRetryAfter
+	case p.MaxDelay > 0:
+		return p.MaxDelay
+	}
+
+	return DefaultMaxRetryAfter
+}
+
+// retryAfter разбирает заголовок Retry-After в секундах или в виде HTTP-даты.
+func retryAfter(h http.Header) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(v); err == nil && sec >= 0 {
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// sleepContext ждет d или отмены ctx. Если ожидание не укладывается
+// в дедлайн ctx, сразу возвращает context.DeadlineExceeded.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if ctx == nil {
+		time.Sleep(d)
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return context.DeadlineExceeded
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,207 @@
+package binomv2postback
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000, 1000}
+	for i, w := range want {
+		if got := p.delay(i+1, nil); got != w*time.Millisecond {
+			t.Errorf("delay(%d) = %s, want %s", i+1, got, w*time.Millisecond)
+		}
+	}
+
+	// без MaxDelay задержка растет без ограничения
+	p.MaxDelay = 0
+	if got := p.delay(6, nil); got != 3200*time.Millisecond {
+		t.Errorf("delay(6) without MaxDelay = %s", got)
+	}
+	if got := (RetryPolicy{}).delay(3, nil); got != 0 {
+		t.Errorf("zero policy delay = %s", got)
+	}
+	if n := (RetryPolicy{}).attempts(); n != 1 {
+		t.Errorf("zero policy attempts = %d", n)
+	}
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Second, Jitter: 0.2}
+	lo, hi := 800*time.Millisecond, 1200*time.Millisecond
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 1000; i++ {
+		d := p.delay(3, nil)
+		if d < lo || d > hi {
+			t.Fatalf("delay with jitter = %s, want %s..%s", d, lo, hi)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("jitter does not spread the delay: %v", seen)
+	}
+
+	// разброс больше 1 не делает задержку отрицательной
+	p.Jitter = 3
+	for i := 0; i < 1000; i++ {
+		if d := p.delay(1, nil); d < 0 {
+			t.Fatalf("negative delay %s", d)
+		}
+	}
+}
+
+func TestRetryPolicyRetryAfter(t *testing.T) {
+	header := func(v string) *clickResp {
+		return &clickResp{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {v}}}
+	}
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		resp   *clickResp
+		want   time.Duration
+	}{
+		{"seconds", RetryPolicy{BaseDelay: time.Millisecond}, header("2"), 2 * time.Second},
+		{"MaxRetryAfter cap", RetryPolicy{MaxRetryAfter: time.Second, MaxDelay: time.Minute}, header("10"), time.Second},
+		{"MaxDelay cap", RetryPolicy{MaxDelay: 3 * time.Second}, header("10"), 3 * time.Second},
+		{"default cap", RetryPolicy{}, header("3600"), DefaultMaxRetryAfter},
+		{"past date", RetryPolicy{}, header("Mon, 02 Jan 2006 15:04:05 GMT"), 0},
+		{"invalid", RetryPolicy{BaseDelay: 50 * time.Millisecond}, header("soon"), 50 * time.Millisecond},
+		{"negative", RetryPolicy{BaseDelay: 50 * time.Millisecond}, header("-1"), 50 * time.Millisecond},
+		{"no header", RetryPolicy{BaseDelay: 50 * time.Millisecond}, &clickResp{StatusCode: http.StatusServiceUnavailable}, 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.delay(1, tt.resp); got != tt.want {
+			t.Errorf("%s: delay = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	date := header(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if got := (RetryPolicy{MaxRetryAfter: 2 * time.Hour}).delay(1, date); got < 58*time.Minute || got > time.Hour {
+		t.Errorf("date delay = %s", got)
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	p := DefaultRetryPolicy()
+	for _, code := range []int{429, 500, 502, 503, 504} {
+		if !p.retryable(context.Background(), &clickResp{StatusCode: code}, nil) {
+			t.Errorf("%d is not retryable", code)
+		}
+	}
+	for _, code := range []int{200, 400, 401, 404, 501} {
+		if p.retryable(context.Background(), &clickResp{StatusCode: code}, nil) {
+			t.Errorf("%d is retryable", code)
+		}
+	}
+
+	timeout := &TransportError{Err: context.DeadlineExceeded}
+	if !p.retryable(context.Background(), nil, timeout) {
+		t.Error("transport timeout is not retryable")
+	}
+	if p.retryable(context.Background(), nil, &TransportError{Err: context.Canceled}) {
+		t.Error("canceled transport request is retryable")
+	}
+	if p.retryable(context.Background(), nil, errors.New("rate limit wait")) {
+		t.Error("error without response is retryable")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if p.retryable(ctx, &clickResp{StatusCode: http.StatusServiceUnavailable}, nil) {
+		t.Error("retry after the context is canceled")
+	}
+	if (RetryPolicy{}).retryable(context.Background(), &clickResp{StatusCode: http.StatusServiceUnavailable}, nil) {
+		t.Error("policy without status codes retries 503")
+	}
+}
+
+// retryTransport отвечает кодами codes по очереди, последний код повторяется
+func retryTransport(requests *atomic.Int32, header http.Header, codes ...int) Transport {
+	return TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		n := int(requests.Add(1))
+		if n > len(codes) {
+			n = len(codes)
+		}
+		return &TransportResponse{StatusCode: codes[n-1], Header: header}, nil
+	})
+}
+
+func TestClientRetry(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:          3,
+		BaseDelay:            time.Millisecond,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+	tests := []struct {
+		name  string
+		codes []int
+		sent  int32
+		ok    bool
+	}{
+		{"recovers", []int{503, 503, 200}, 3, true},
+		{"exhausted", []int{503}, 3, false},
+		{"permanent", []int{503, 400}, 2, false},
+		{"first attempt", []int{200}, 1, true},
+	}
+	for _, tt := range tests {
+		var requests atomic.Int32
+		cli := newDedupTestClient(t, retryTransport(&requests, nil, tt.codes...), WithRetryPolicy(policy))
+		err := cli.SendEvent("c1", binom.Event(1, 1))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+		var statusErr *HTTPStatusError
+		if err != nil && !errors.As(err, &statusErr) {
+			t.Errorf("%s: err = %T, want *HTTPStatusError", tt.name, err)
+		}
+		if n := requests.Load(); n != tt.sent {
+			t.Errorf("%s: sent %d requests, want %d", tt.name, n, tt.sent)
+		}
+	}
+
+	// OptNoRetry отключает повторы для одного запроса
+	var requests atomic.Int32
+	cli := newDedupTestClient(t, retryTransport(&requests, nil, 503), WithRetryPolicy(policy))
+	if err := cli.SendEvent("c1", binom.Event(1, 1), OptNoRetry()); err == nil || requests.Load() != 1 {
+		t.Errorf("OptNoRetry: %v, %d requests", err, requests.Load())
+	}
+}
+
+func TestClientRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	policy := RetryPolicy{
+		MaxAttempts:          2,
+		MaxRetryAfter:        20 * time.Millisecond,
+		RetryableStatusCodes: []int{http.StatusTooManyRequests},
+	}
+	cli := newDedupTestClient(t, retryTransport(&requests, http.Header{"Retry-After": {"3600"}}, 429, 200), WithRetryPolicy(policy))
+
+	start := time.Now()
+	if err := cli.SendEvent("c1", binom.Event(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond || d > time.Second {
+		t.Errorf("retry waited %s, want the 20ms cap", d)
+	}
+
+	// ожидание, не укладывающееся в дедлайн, не начинается
+	requests.Store(0)
+	policy.MaxRetryAfter = time.Minute
+	cli = newDedupTestClient(t, retryTransport(&requests, http.Header{"Retry-After": {"30"}}, 429, 200), WithRetryPolicy(policy))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start = time.Now()
+	var statusErr *HTTPStatusError
+	if err := cli.SendEvent("c1", binom.Event(1, 1), OptWithContext(ctx)); !errors.As(err, &statusErr) || statusErr.StatusCode != 429 {
+		t.Errorf("retry past the deadline: %v", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond || requests.Load() != 1 {
+		t.Errorf("waited %s and sent %d requests past the deadline", d, requests.Load())
+	}
+}
@@ -0,0 +1,167 @@
+package binomv2postback
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+// Виды запросов к трекеру в структурных логах
+const (
+	RequestKindEventUpdate = "event_update" // обновление событий клика (upd_clickid)
+	RequestKindConversion  = "conversion"   // конверсия (cnv_id)
+	RequestKindBaseClick   = "base_click"   // создание базового клика
+	RequestKindLPClick     = "lp_click"     // клик по лендингу
+	RequestKindOfferClick  = "offer_click"  // клик по офферу
+)
+
+// requestInfo сведения о запросе к трекеру для логов, метрик и трассировки
+type requestInfo struct {
+	kind    string
+	clickID string
+}
+
+// parseRequestInfo определяет вид запроса и clickID по его аргументам.
+func parseRequestInfo(query string) requestInfo {
+	q, _ := url.ParseQuery(query)
+	switch {
+	case q.Has("upd_clickid"):
+		return requestInfo{kind: RequestKindEventUpdate, clickID: q.Get("upd_clickid")}
+	case q.Has("cnv_id"):
+		return requestInfo{kind: RequestKindConversion, clickID: q.Get("cnv_id")}
+	case q.Has("uclick"):
+		return requestInfo{kind: RequestKindOfferClick, clickID: q.Get("uclick")}
+	case q.Has("lpbcid"):
+		if q.Has("key") {
+			return requestInfo{kind: RequestKindBaseClick}
+		}
+		return requestInfo{kind: RequestKindLPClick, clickID: q.Get("lpbcid")}
+	}
+
+	return requestInfo{kind: RequestKindBaseClick}
+}
+
+// WithSlog включает структурный лог каждой попытки запроса к трекеру:
+// click_id, kind, host, status, latency, attempt и dry_run.
+// Успешные попытки пишутся с уровнем Info, неудачные с Warn,
+// последняя неудачная попытка с Error.
+func WithSlog(l *slog.Logger) ClientOption {
+	return func(cli *client) error {
+		cli.slog = l
+		return nil
+	}
+}
+
+// logAttempt пишет попытку запроса в Logger и структурную запись в slog.
+func (cli *client) logAttempt(clkReq *clickReq, query string, resp *clickResp, err error, latency time.Duration, final bool) {
+	if clkReq.log != nil {
+		cli.logAttemptText(clkReq, query, resp, err)
+	}
+	if cli.slog == nil {
+		return
+	}
+	ctx := clkReq.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	level := slog.LevelInfo
+	switch {
+	case err != nil && final:
+		level = slog.LevelError
+	case err != nil:
+		level = slog.LevelWarn
+	}
+	if !cli.slog.Enabled(ctx, level) {
+		return
+	}
+
+	info := parseRequestInfo(query)
+	attrs := []slog.Attr{
+		slog.String("click_id", info.clickID),
+		slog.String("kind", info.kind),
+		slog.String("host", requestHost(clkReq.clickBaseURL)),
+		slog.Duration("latency", latency),
+		slog.Int("attempt", clkReq.attempt),
+		slog.Bool("dry_run", clkReq.dryRun),
+	}
+	if resp != nil && !resp.DryRun {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	cli.slog.LogAttrs(ctx, level, "binom request", attrs...)
+}
+
+// logAttemptText пишет попытку запроса в Logger с уровнем Debug:
+// адрес без секретных аргументов, код и начало тела ответа.
+func (cli *client) logAttemptText(clkReq *clickReq, query string, resp *clickResp, err error) {
+	if clkReq.waited > 0 {
+		clkReq.log.Debugf("Binom request to %s waited %s for rate limit", requestHost(clkReq.clickBaseURL), clkReq.waited)
+	}
+	switch {
+	case resp != nil && resp.DryRun:
+		// запрос уже выведен printDryRun
+	case resp != nil:
+		clkReq.log.Debugf("Binom request: %s %s Response: %d %s", clkReq.method, resp.RedactedURL, resp.StatusCode, logBody(resp.Body, cli.sensitiveParams))
+	default:
+		clkReq.log.Debugf("Binom request: %s %s failed: %v", clkReq.method, requestURL(clkReq.clickBaseURL, query, cli.sensitiveParams), err)
+	}
+}
+
+// requestURL возвращает адрес запроса без значений секретных аргументов
+func requestURL(clickBaseURL, query string, params []string) string {
+	u, err := url.Parse(clickBaseURL)
+	if err != nil {
+		return redactString(clickBaseURL, params)
+	}
+	u.RawQuery = query
+
+	return redactURLParams(u, params)
+}
+
+// requestHost возвращает хост адреса обработчика клика
+func requestHost(clickBaseURL string) string {
+	u, err := url.Parse(clickBaseURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
+}
+
+// slogLogger адаптер *slog.Logger к Logger
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger возвращает Logger, пишущий в l.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return &slogLogger{l: l}
+}
+
+func (s *slogLogger) Info(args ...interface{}) {
+	s.l.Info(fmt.Sprint(args...))
+}
+
+func (s *slogLogger) Infof(template string, args ...interface{}) {
+	s.l.Info(fmt.Sprintf(template, args...))
+}
+
+func (s *slogLogger) Error(args ...interface{}) {
+	s.l.Error(fmt.Sprint(args...))
+}
+
+func (s *slogLogger) Errorf(template string, args ...interface{}) {
+	s.l.Error(fmt.Sprintf(template, args...))
+}
+
+func (s *slogLogger) Debug(args ...interface{}) {
+	s.l.Debug(fmt.Sprint(args...))
+}
+
+func (s *slogLogger) Debugf(template string, args ...interface{}) {
+	s.l.Debug(fmt.Sprintf(template, args...))
+}
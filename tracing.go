@@ -0,0 +1,217 @@
+package binomv2postback
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Атрибуты span запросов к трекеру
+const (
+	TraceAttrClickID      = "binom.click_id"      // string
+	TraceAttrKind         = "binom.kind"          // string, RequestKind*
+	TraceAttrEventIndices = "binom.event_indices" // []int, номера событий запроса
+	TraceAttrConversion   = "binom.conversion"    // bool, запрос конверсии
+	TraceAttrAttempt      = "binom.attempt"       // int, номер попытки
+	TraceAttrDryRun       = "binom.dry_run"       // bool
+	TraceAttrHost         = "server.address"      // string
+	TraceAttrHTTPStatus   = "http.response.status_code"
+)
+
+// Имена span запросов к трекеру
+const (
+	SpanNameSend    = "binom.send"    // отправка запроса со всеми попытками
+	SpanNameAttempt = "binom.attempt" // одна попытка запроса
+)
+
+// Tracer открывает span вокруг отправки запросов к трекеру.
+// Интерфейс повторяет устройство OpenTelemetry: адаптер к trace.Tracer
+// и propagation.TextMapPropagator пишется в несколько строк.
+type Tracer interface {
+	// Start открывает span name дочерним к span из ctx и возвращает контекст с новым span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+	// Inject записывает контекст трассировки ctx в заголовки исходящего запроса.
+	Inject(ctx context.Context, header http.Header)
+}
+
+// Span операция в трассировке.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	// End завершает span, err != nil отмечает операцию неуспешной.
+	End(err error)
+}
+
+// WithTracer включает трассировку: span на каждую отправку запроса
+// и дочерний span на каждую попытку. Контекст трассировки из OptWithContext
+// передается трекеру в заголовках запроса.
+func WithTracer(tracer Tracer) ClientOption {
+	return func(cli *client) error {
+		if tracer == nil {
+			return errors.New("nil tracer")
+		}
+		cli.tracer = tracer
+		return nil
+	}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) End(error)                        {}
+
+// startSpan открывает span, если задан Tracer. Без Tracer ctx возвращается как есть.
+func (cli *client) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if cli.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return cli.tracer.Start(ctx, name)
+}
+
+// setSpanRequest добавляет к span сведения о запросе из его аргументов.
+func setSpanRequest(span Span, clkReq *clickReq, query string) {
+	if _, ok := span.(noopSpan); ok {
+		return
+	}
+	info := parseRequestInfo(query)
+	span.SetAttribute(TraceAttrClickID, info.clickID)
+	span.SetAttribute(TraceAttrKind, info.kind)
+	span.SetAttribute(TraceAttrConversion, info.kind == RequestKindConversion)
+	span.SetAttribute(TraceAttrEventIndices, eventIndices(query))
+	span.SetAttribute(TraceAttrHost, requestHost(clkReq.clickBaseURL))
+	span.SetAttribute(TraceAttrDryRun, clkReq.dryRun)
+}
+
+// eventIndices возвращает номера событий eventX и add_eventX из аргументов запроса.
+func eventIndices(query string) []int {
+	q, _ := url.ParseQuery(query)
+	indices := []int{}
+	for name := range q {
+		name = strings.TrimPrefix(name, "add_")
+		if !strings.HasPrefix(name, "event") {
+			continue
+		}
+		if index, err := strconv.Atoi(strings.TrimPrefix(name, "event")); err == nil {
+			indices = append(indices, index)
+		}
+	}
+	sort.Ints(indices)
+
+	return indices
+}
+
+// RecordedSpan span, записанный TraceRecorder.
+type RecordedSpan struct {
+	Name         string
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Attributes   map[string]interface{}
+	Err          error
+	Start        time.Time
+	End          time.Time
+}
+
+// TraceRecorder Tracer, хранящий завершенные span в памяти, для тестов и отладки.
+// Контекст трассировки передается в заголовке traceparent (W3C Trace Context).
+type TraceRecorder struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+// NewTraceRecorder создает пустой TraceRecorder.
+func NewTraceRecorder() *TraceRecorder {
+	return &TraceRecorder{}
+}
+
+type recordedSpanKey struct{}
+
+type recorderSpan struct {
+	recorder *TraceRecorder
+
+	mu   sync.Mutex
+	span RecordedSpan
+}
+
+func (r *TraceRecorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	s := &recorderSpan{
+		recorder: r,
+		span: RecordedSpan{
+			Name:       name,
+			TraceID:    randomHex(16),
+			SpanID:     randomHex(8),
+			Attributes: make(map[string]interface{}),
+			Start:      time.Now(),
+		},
+	}
+	if parent, ok := ctx.Value(recordedSpanKey{}).(*recorderSpan); ok {
+		s.span.TraceID = parent.span.TraceID
+		s.span.ParentSpanID = parent.span.SpanID
+	}
+
+	return context.WithValue(ctx, recordedSpanKey{}, s), s
+}
+
+func (r *TraceRecorder) Inject(ctx context.Context, header http.Header) {
+	if s, ok := ctx.Value(recordedSpanKey{}).(*recorderSpan); ok {
+		header.Set("traceparent", "00-"+s.span.TraceID+"-"+s.span.SpanID+"-01")
+	}
+}
+
+// Spans возвращает завершенные span в порядке завершения.
+func (r *TraceRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]RecordedSpan(nil), r.spans...)
+}
+
+// Reset удаляет записанные span.
+func (r *TraceRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.spans = nil
+}
+
+func (s *recorderSpan) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.span.Attributes[key] = value
+}
+
+func (s *recorderSpan) End(err error) {
+	s.mu.Lock()
+	s.span.Err = err
+	s.span.End = time.Now()
+	span := s.span
+	attrs := make(map[string]interface{}, len(s.span.Attributes))
+	for k, v := range s.span.Attributes {
+		attrs[k] = v
+	}
+	span.Attributes = attrs
+	s.mu.Unlock()
+
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.recorder.spans = append(s.recorder.spans, span)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
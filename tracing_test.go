@@ -0,0 +1,131 @@
+package binomv2postback
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/CLi-Ter/binomv2-postback/binom"
+)
+
+func TestTraceRecorderSpanNesting(t *testing.T) {
+	recorder := NewTraceRecorder()
+	var traceparents []string
+	transport := TransportFunc(func(req *TransportRequest) (*TransportResponse, error) {
+		traceparents = append(traceparents, req.Header.Get("traceparent"))
+		if len(traceparents) == 1 {
+			return &TransportResponse{StatusCode: http.StatusServiceUnavailable}, nil
+		}
+		return &TransportResponse{StatusCode: http.StatusOK, Body: []byte("click updated")}, nil
+	})
+	cli, err := New(
+		WithClickBaseURL("https://binom.example/click.php"),
+		WithTransport(transport),
+		WithTracer(recorder),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, RetryableStatusCodes: []int{http.StatusServiceUnavailable}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, root := recorder.Start(context.Background(), "handler")
+	events, err := NewEvents(binom.Event(2, 1), binom.AddEvent(5, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.SendEvents("click-1", events, OptWithContext(ctx)); err != nil {
+		t.Fatalf("SendEvents: %v", err)
+	}
+	root.End(nil)
+
+	spans := recorder.Spans()
+	if len(spans) != 4 {
+		t.Fatalf("got %d spans, want 4: %+v", len(spans), spans)
+	}
+	first, second, send, handler := spans[0], spans[1], spans[2], spans[3]
+	if first.Name != SpanNameAttempt || second.Name != SpanNameAttempt || send.Name != SpanNameSend || handler.Name != "handler" {
+		t.Fatalf("span names: %q %q %q %q", first.Name, second.Name, send.Name, handler.Name)
+	}
+	if handler.ParentSpanID != "" {
+		t.Errorf("root span has parent %q", handler.ParentSpanID)
+	}
+	if send.ParentSpanID != handler.SpanID {
+		t.Errorf("send span parent = %q, want %q", send.ParentSpanID, handler.SpanID)
+	}
+	for _, attempt := range []RecordedSpan{first, second} {
+		if attempt.ParentSpanID != send.SpanID {
+			t.Errorf("attempt span parent = %q, want %q", attempt.ParentSpanID, send.SpanID)
+		}
+	}
+	for _, span := range spans {
+		if span.TraceID != handler.TraceID {
+			t.Errorf("span %s trace id = %q, want %q", span.Name, span.TraceID, handler.TraceID)
+		}
+	}
+
+	if first.Err == nil || second.Err != nil || send.Err != nil {
+		t.Errorf("span errors: first %v, second %v, send %v", first.Err, second.Err, send.Err)
+	}
+	if first.Attributes[TraceAttrAttempt] != 1 || second.Attributes[TraceAttrAttempt] != 2 {
+		t.Errorf("attempt attributes: %v, %v", first.Attributes[TraceAttrAttempt], second.Attributes[TraceAttrAttempt])
+	}
+	if got := first.Attributes[TraceAttrHTTPStatus]; got != http.StatusServiceUnavailable {
+		t.Errorf("first attempt status = %v", got)
+	}
+	if got := send.Attributes[TraceAttrClickID]; got != "click-1" {
+		t.Errorf("click id attribute = %v", got)
+	}
+	if got := send.Attributes[TraceAttrKind]; got != RequestKindEventUpdate {
+		t.Errorf("kind attribute = %v", got)
+	}
+	if got, ok := send.Attributes[TraceAttrEventIndices].([]int); !ok || len(got) != 2 || got[0] != 2 || got[1] != 5 {
+		t.Errorf("event indices attribute = %v", send.Attributes[TraceAttrEventIndices])
+	}
+	if got := send.Attributes[TraceAttrHost]; got != "binom.example" {
+		t.Errorf("host attribute = %v", got)
+	}
+
+	// каждая попытка передает трекеру свой span
+	want := []string{
+		"00-" + handler.TraceID + "-" + first.SpanID + "-01",
+		"00-" + handler.TraceID + "-" + second.SpanID + "-01",
+	}
+	if len(traceparents) != 2 || traceparents[0] != want[0] || traceparents[1] != want[1] {
+		t.Errorf("traceparent headers = %q, want %q", traceparents, want)
+	}
+}
+
+func TestTraceRecorderInject(t *testing.T) {
+	recorder := NewTraceRecorder()
+
+	header := http.Header{}
+	recorder.Inject(context.Background(), header)
+	if got := header.Get("traceparent"); got != "" {
+		t.Errorf("traceparent without span = %q", got)
+	}
+
+	ctx, span := recorder.Start(context.Background(), "op")
+	recorder.Inject(ctx, header)
+	span.End(errors.New("failed"))
+
+	recorded := recorder.Spans()
+	if len(recorded) != 1 {
+		t.Fatalf("got %d spans, want 1", len(recorded))
+	}
+	if len(recorded[0].TraceID) != 32 || len(recorded[0].SpanID) != 16 {
+		t.Errorf("trace id %q, span id %q", recorded[0].TraceID, recorded[0].SpanID)
+	}
+	want := "00-" + recorded[0].TraceID + "-" + recorded[0].SpanID + "-01"
+	if got := header.Get("traceparent"); got != want {
+		t.Errorf("traceparent = %q, want %q", got, want)
+	}
+	if recorded[0].Err == nil {
+		t.Error("span error not recorded")
+	}
+
+	recorder.Reset()
+	if n := len(recorder.Spans()); n != 0 {
+		t.Errorf("%d spans after Reset", n)
+	}
+}
@@ -0,0 +1,118 @@
+package binomv2postback
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Transport доставляет запрос к обработчику клика трекера.
+// По умолчанию используется HTTPTransport, но запросы можно
+// отправлять и через шину сообщений или подменять в тестах.
+type Transport interface {
+	Send(req *TransportRequest) (*TransportResponse, error)
+}
+
+// TransportFunc позволяет использовать функцию как Transport.
+type TransportFunc func(req *TransportRequest) (*TransportResponse, error)
+
+func (f TransportFunc) Send(req *TransportRequest) (*TransportResponse, error) {
+	return f(req)
+}
+
+// TransportRequest запрос к трекеру: метод, URL с аргументами Binom, заголовки и контекст.
+type TransportRequest struct {
+	*http.Request
+	// FollowRedirects переходить ли по редиректу. При создании клика
+	// clickID приходит в редиректе, поэтому по нему не переходят.
+	FollowRedirects bool
+}
+
+// TransportResponse ответ трекера.
+type TransportResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Truncated  bool // тело длиннее MaxResponseBodySize и обрезано
+}
+
+// HTTPTransport отправляет запросы через http.Client.
+type HTTPTransport struct {
+	client *http.Client
+}
+
+// NewHTTPTransport создает HTTPTransport. Если httpClient nil, используется новый http.Client.
+func NewHTTPTransport(httpClient *http.Client) *HTTPTransport {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	return &HTTPTransport{client: httpClient}
+}
+
+func (t *HTTPTransport) Send(req *TransportRequest) (*TransportResponse, error) {
+	httpClient := t.client
+	if !req.FollowRedirects {
+		noRedirectClient := *httpClient
+		noRedirectClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		httpClient = &noRedirectClient
+	}
+
+	response, err := httpClient.Do(req.Request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, MaxResponseBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	truncated := len(body) > MaxResponseBodySize
+	if truncated {
+		body = body[:MaxResponseBodySize]
+	}
+
+	return &TransportResponse{
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+		Body:       body,
+		Truncated:  truncated,
+	}, nil
+}
+
+// WithTransport задает Transport, через который клиент отправляет запросы.
+func WithTransport(transport Transport) ClientOption {
+	return func(cli *client) error {
+		if transport == nil {
+			return errors.New("nil transport")
+		}
+		cli.transport = transport
+		return nil
+	}
+}
+
+// WithHTTPClient задает http.Client с нужными таймаутами, прокси или mTLS.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(cli *client) error {
+		if httpClient == nil {
+			return errors.New("nil http client")
+		}
+		cli.transport = NewHTTPTransport(httpClient)
+		return nil
+	}
+}
+
+// WithRoundTripper задает http.RoundTripper для http.Client клиента.
+func WithRoundTripper(rt http.RoundTripper) ClientOption {
+	return func(cli *client) error {
+		if rt == nil {
+			return errors.New("nil round tripper")
+		}
+		cli.transport = NewHTTPTransport(&http.Client{Transport: rt})
+		return nil
+	}
+}
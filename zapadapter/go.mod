@@ -0,0 +1,17 @@
+module github.com/CLi-Ter/binomv2-postback/zapadapter
+
+go 1.21
+
+require (
+	github.com/CLi-Ter/binomv2-postback v0.0.0
+	go.uber.org/zap v1.27.0
+)
+
+require (
+	go.uber.org/multierr v1.10.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// модуль собирается с клиентом из этого репозитория; при выпуске require
+// указывает выпущенную версию github.com/CLi-Ter/binomv2-postback
+replace github.com/CLi-Ter/binomv2-postback => ../
@@ -0,0 +1,125 @@
+// Package zapadapter подключает zap к клиенту Binom:
+// как Logger и как обработчик структурных записей log/slog (WithSlog).
+//
+//	z, _ := zap.NewProduction()
+//	cli, err := binomv2postback.New(
+//		binomv2postback.WithClickBaseURL(clickURL),
+//		binomv2postback.WithLogger(zapadapter.NewLogger(z)),
+//		binomv2postback.WithSlog(slog.New(zapadapter.NewHandler(z))),
+//	)
+//
+// Адаптер - отдельный модуль, чтобы клиент не зависел от zap:
+//
+//	go get github.com/CLi-Ter/binomv2-postback/zapadapter
+package zapadapter
+
+import (
+	"context"
+	"log/slog"
+
+	binomv2postback "github.com/CLi-Ter/binomv2-postback"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewLogger возвращает Logger, пишущий в l.
+func NewLogger(l *zap.Logger) binomv2postback.Logger {
+	return l.Sugar()
+}
+
+// Handler slog.Handler, пишущий записи в zap.Logger с атрибутами как полями zap.
+type Handler struct {
+	l      *zap.Logger
+	prefix string // группа slog, добавляется к именам полей через точку
+}
+
+// NewHandler создает slog.Handler поверх l.
+func NewHandler(l *zap.Logger) *Handler {
+	return &Handler{l: l}
+}
+
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.l.Core().Enabled(zapLevel(level))
+}
+
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	ce := h.l.Check(zapLevel(r.Level), r.Message)
+	if ce == nil {
+		return nil
+	}
+	fields := make([]zap.Field, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		fields = h.appendAttr(fields, h.prefix, a)
+		return true
+	})
+	ce.Time = r.Time
+	ce.Write(fields...)
+
+	return nil
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make([]zap.Field, 0, len(attrs))
+	for _, a := range attrs {
+		fields = h.appendAttr(fields, h.prefix, a)
+	}
+
+	return &Handler{l: h.l.With(fields...), prefix: h.prefix}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return &Handler{l: h.l, prefix: h.prefix + name + "."}
+}
+
+func (h *Handler) appendAttr(fields []zap.Field, prefix string, a slog.Attr) []zap.Field {
+	v := a.Value.Resolve()
+	if a.Key == "" && v.Kind() != slog.KindGroup {
+		return fields
+	}
+	key := prefix + a.Key
+
+	switch v.Kind() {
+	case slog.KindGroup:
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix = key + "."
+		}
+		for _, ga := range v.Group() {
+			fields = h.appendAttr(fields, groupPrefix, ga)
+		}
+		return fields
+	case slog.KindString:
+		return append(fields, zap.String(key, v.String()))
+	case slog.KindInt64:
+		return append(fields, zap.Int64(key, v.Int64()))
+	case slog.KindUint64:
+		return append(fields, zap.Uint64(key, v.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, zap.Float64(key, v.Float64()))
+	case slog.KindBool:
+		return append(fields, zap.Bool(key, v.Bool()))
+	case slog.KindDuration:
+		return append(fields, zap.Duration(key, v.Duration()))
+	case slog.KindTime:
+		return append(fields, zap.Time(key, v.Time()))
+	}
+
+	return append(fields, zap.Any(key, v.Any()))
+}
+
+func zapLevel(level slog.Level) zapcore.Level {
+	switch {
+	case level >= slog.LevelError:
+		return zapcore.ErrorLevel
+	case level >= slog.LevelWarn:
+		return zapcore.WarnLevel
+	case level >= slog.LevelInfo:
+		return zapcore.InfoLevel
+	}
+
+	return zapcore.DebugLevel
+}